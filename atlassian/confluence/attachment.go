@@ -1,5 +1,10 @@
 package confluence
 
+import (
+	"path"
+	"time"
+)
+
 // AttachmentResults Results
 type AttachmentResults struct {
 	Results []AttachmentFetchResult `json:"results"`
@@ -17,6 +22,7 @@ type AttachmentFetchResult struct {
 	Title      string               `json:"title"`
 	MetaData   AttachmentMetaData   `json:"metadata"`
 	Extensions AttachmentExtensions `json:"extensions"`
+	Version    Version              `json:"version"`
 	Expandable AttachmentExpandable `json:"_expandable"`
 	Links      AttachmentLinks      `json:"_links"`
 }
@@ -65,3 +71,92 @@ type AttachmentLinks struct {
 	Download  string `json:"download"`
 	Thumbnail string `json:"thumbnail"`
 }
+
+// AttachmentFilter 添付ファイルの絞り込み条件
+// ゼロ値のフィールドは条件にしない
+type AttachmentFilter struct {
+	// MediaTypes いずれかに一致するもの。"image/*"のようなパターンも使える
+	MediaTypes []string
+	// NamePattern ファイル名のglob。path.Matchの書式
+	NamePattern string
+	// MinSize 以上のサイズ
+	MinSize int64
+	// MaxSize 以下のサイズ
+	MaxSize int64
+	// Label このラベルが付いているもの
+	Label string
+	// UploadedAfter この時刻より後にアップロードされたもの
+	UploadedAfter time.Time
+}
+
+// Match attachmentがfilterの条件をすべて満たすか
+func (t AttachmentFilter) Match(attachment AttachmentFetchResult) bool {
+	if len(t.MediaTypes) > 0 && !matchMediaType(t.MediaTypes, attachment.MediaType()) {
+		return false
+	}
+	if t.NamePattern != "" {
+		matched, err := path.Match(t.NamePattern, attachment.Title)
+		if err != nil || !matched {
+			return false
+		}
+	}
+	size := int64(attachment.Extensions.FileSize)
+	if t.MinSize > 0 && size < t.MinSize {
+		return false
+	}
+	if t.MaxSize > 0 && t.MaxSize < size {
+		return false
+	}
+	if t.Label != "" && !attachment.HasLabel(t.Label) {
+		return false
+	}
+	if !t.UploadedAfter.IsZero() {
+		uploaded, err := time.Parse(time.RFC3339, attachment.Version.When)
+		if err != nil || !uploaded.After(t.UploadedAfter) {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterAttachments filterに一致する添付ファイルだけを返す
+func FilterAttachments(attachments []AttachmentFetchResult, filter AttachmentFilter) []AttachmentFetchResult {
+	var ret []AttachmentFetchResult
+	for _, v := range attachments {
+		if filter.Match(v) {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// MediaType メディアタイプを返す
+func (t AttachmentFetchResult) MediaType() string {
+	if t.MetaData.MediaType != "" {
+		return t.MetaData.MediaType
+	}
+	return t.Extensions.MediaType
+}
+
+// HasLabel labelが付いているか
+func (t AttachmentFetchResult) HasLabel(label string) bool {
+	for _, v := range t.MetaData.Labels.Results {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if m["name"] == label {
+			return true
+		}
+	}
+	return false
+}
+
+func matchMediaType(patterns []string, mediaType string) bool {
+	for _, p := range patterns {
+		if matched, err := path.Match(p, mediaType); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
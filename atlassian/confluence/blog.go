@@ -0,0 +1,72 @@
+package confluence
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/naminomare/gogutil/atlassian/rest"
+)
+
+var (
+	// PostingDayFormat postingDayのフォーマット
+	PostingDayFormat = "2006-01-02"
+
+	cqlDateFormat = "2006-01-02 15:04"
+)
+
+// CreateBlogPost ブログ投稿を作成する
+func (t *Client) CreateBlogPost(spaceKey, title, content string) (*http.Response, error) {
+	return t.CreateContent(spaceKey, "", title, content, PageTypeBlog)
+}
+
+// FetchBlogPosts スペースのブログ投稿を作成日時で絞り込んで取得する
+// from, toがゼロ値の場合はその方向には絞り込まない
+func (t *Client) FetchBlogPosts(
+	spaceKey string,
+	from,
+	to time.Time,
+	start,
+	limit int,
+) (*ContentResults, error) {
+	cql := "type=" + string(PageTypeBlog) + " and space=" + QuoteCQL(spaceKey)
+	if !from.IsZero() {
+		cql += " and created >= " + QuoteCQL(from.Format(cqlDateFormat))
+	}
+	if !to.IsZero() {
+		cql += " and created < " + QuoteCQL(to.Format(cqlDateFormat))
+	}
+	cql += " order by created desc"
+
+	query := rest.SetPaging(url.Values{
+		"cql":    {cql},
+		"expand": {"version,space"},
+	}, "start", start, "limit", limit)
+	var res ContentResults
+	err := t.rest.DoDecode(http.MethodGet, "/rest/api/content/search", query, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// FetchBlogPostByPostingDay 投稿日とタイトルでブログ投稿を取得する
+// 見つからなかった場合はErrNotFoundを返す
+func (t *Client) FetchBlogPostByPostingDay(spaceKey string, postingDay time.Time, title string) (*Content, error) {
+	query := url.Values{
+		"type":       {string(PageTypeBlog)},
+		"spaceKey":   {spaceKey},
+		"postingDay": {postingDay.Format(PostingDayFormat)},
+		"title":      {title},
+		"expand":     {"body.storage,version,space"},
+	}
+	var res ContentResults
+	err := t.rest.DoDecode(http.MethodGet, "/rest/api/content", query, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Results) == 0 {
+		return nil, ErrNotFound
+	}
+	return &res.Results[0], nil
+}
@@ -0,0 +1,227 @@
+package confluence
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/naminomare/gogutil/atlassian/rest"
+)
+
+// CommentLocation コメントの位置
+type CommentLocation string
+
+var (
+	// CommentLocationAll すべて
+	CommentLocationAll CommentLocation = ""
+
+	// CommentLocationFooter ページ下部のコメント
+	CommentLocationFooter CommentLocation = "footer"
+
+	// CommentLocationInline インラインコメント
+	CommentLocationInline CommentLocation = "inline"
+
+	// ErrNotSupported サーバーが対応していない時
+	ErrNotSupported = errors.New("サーバーが対応していません")
+)
+
+// Comment コメント
+type Comment struct {
+	ID         string            `json:"id"`
+	Type       string            `json:"type"`
+	Status     string            `json:"status"`
+	Title      string            `json:"title"`
+	Version    Version           `json:"version"`
+	Body       ContentBody       `json:"body"`
+	Ancestors  []Content         `json:"ancestors"`
+	Container  Content           `json:"container"`
+	Extensions CommentExtensions `json:"extensions"`
+	Links      map[string]string `json:"_links"`
+}
+
+// CommentExtensions Extensions
+type CommentExtensions struct {
+	Location         string                  `json:"location"`
+	Resolution       CommentResolution       `json:"resolution"`
+	InlineProperties CommentInlineProperties `json:"inlineProperties"`
+}
+
+// CommentResolution インラインコメントの解決状態
+type CommentResolution struct {
+	Status           string `json:"status"`
+	LastModifier     User   `json:"lastModifier"`
+	LastModifiedDate string `json:"lastModifiedDate"`
+}
+
+// CommentInlineProperties インラインコメントの対象
+type CommentInlineProperties struct {
+	OriginalSelection string `json:"originalSelection"`
+	MarkerRef         string `json:"markerRef"`
+}
+
+// CommentResults Results
+type CommentResults struct {
+	Results []Comment         `json:"results"`
+	Start   int               `json:"start"`
+	Limit   int               `json:"limit"`
+	Size    int               `json:"size"`
+	Links   map[string]string `json:"_links"`
+}
+
+// FetchComments ページのコメントを取得する
+// locationがCommentLocationAllの時はすべての位置のコメントを返す
+func (t *Client) FetchComments(pageID string, location CommentLocation, start, limit int) (*CommentResults, error) {
+	query := url.Values{
+		"expand": {"body.storage,version,ancestors,extensions.inlineProperties,extensions.resolution"},
+		"depth":  {"all"},
+	}
+	if location != CommentLocationAll {
+		query.Set("location", string(location))
+	}
+	query = rest.SetPaging(query, "start", start, "limit", limit)
+	var res CommentResults
+	err := t.rest.DoDecode(http.MethodGet, rest.Pathf("/rest/api/content/%s/child/comment", pageID), query, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// FetchAllComments ページのコメントをページングしながらすべて取得する
+func (t *Client) FetchAllComments(pageID string, location CommentLocation) ([]Comment, error) {
+	return rest.FetchAll(0, func(start, limit int) ([]Comment, bool, error) {
+		res, err := t.FetchComments(pageID, location, start, limit)
+		if err != nil {
+			return nil, false, err
+		}
+		return res.Results, res.Links["next"] != "", nil
+	})
+}
+
+// InlineCommentOptions インラインコメントを付ける場所
+type InlineCommentOptions struct {
+	// OriginalSelection コメントを付ける本文中の文字列
+	OriginalSelection string
+	// MatchIndex OriginalSelectionが本文に複数ある時に何番目(0から)に付けるか
+	MatchIndex int
+	// MatchCount OriginalSelectionが本文にいくつあるか。0の場合は1
+	MatchCount int
+}
+
+// AddComment ページやブログ投稿にstorage形式のコメントを投稿する
+func (t *Client) AddComment(containerID, content string) (*http.Response, error) {
+	return t.postComment(containerID, "", content, nil)
+}
+
+// ReplyComment コメントに返信する
+func (t *Client) ReplyComment(containerID, parentCommentID, content string) (*http.Response, error) {
+	return t.postComment(containerID, parentCommentID, content, nil)
+}
+
+// AddInlineComment 本文のopts.OriginalSelectionの部分にインラインコメントを投稿する
+func (t *Client) AddInlineComment(containerID, content string, opts InlineCommentOptions) (*http.Response, error) {
+	if opts.OriginalSelection == "" {
+		return nil, ErrInvalidArguments
+	}
+	return t.postComment(containerID, "", content, &opts)
+}
+
+func (t *Client) postComment(containerID, parentCommentID, content string, inline *InlineCommentOptions) (*http.Response, error) {
+	// ブログ投稿のコメントはcontainerのtypeをblogpostにしないといけない
+	var container Content
+	err := t.rest.DoDecode(http.MethodGet, rest.Pathf("/rest/api/content/%s", containerID), nil, nil, &container)
+	if err != nil {
+		return nil, err
+	}
+	postMap := map[string]interface{}{
+		"type": "comment",
+		"container": map[string]string{
+			"id":   containerID,
+			"type": container.Type,
+		},
+		"body": map[string]interface{}{
+			"storage": map[string]string{
+				"value":          content,
+				"representation": "storage",
+			},
+		},
+	}
+	if parentCommentID != "" {
+		postMap["ancestors"] = []interface{}{
+			map[string]string{
+				"id": parentCommentID,
+			},
+		}
+	}
+	if inline != nil {
+		matchCount := inline.MatchCount
+		if matchCount <= 0 {
+			matchCount = 1
+		}
+		postMap["extensions"] = map[string]interface{}{
+			"location": string(CommentLocationInline),
+			"inlineProperties": map[string]interface{}{
+				"originalSelection": inline.OriginalSelection,
+				"matchIndex":        inline.MatchIndex,
+				"matchCount":        matchCount,
+			},
+		}
+	}
+	return t.rest.Do(http.MethodPost, "/rest/api/content", nil, postMap, nil)
+}
+
+// UpdateComment コメントを更新する
+func (t *Client) UpdateComment(commentID string, currentVersion int, content string) (*http.Response, error) {
+	putMap := map[string]interface{}{
+		"type": "comment",
+		"version": map[string]int{
+			"number": currentVersion + 1,
+		},
+		"body": map[string]interface{}{
+			"storage": map[string]string{
+				"value":          content,
+				"representation": "storage",
+			},
+		},
+	}
+	return t.rest.Do(http.MethodPut, rest.Pathf("/rest/api/content/%s", commentID), nil, putMap, nil)
+}
+
+// DeleteComment コメントを削除する
+func (t *Client) DeleteComment(commentID string) (*http.Response, error) {
+	return t.rest.Do(http.MethodDelete, rest.Pathf("/rest/api/content/%s", commentID), nil, nil, nil)
+}
+
+// ResolveInlineComment インラインコメントを解決済みにする
+// サーバーが対応していない場合はErrNotSupportedを返す
+func (t *Client) ResolveInlineComment(commentID string) error {
+	return t.setInlineCommentResolved(commentID, true)
+}
+
+// ReopenInlineComment 解決済みのインラインコメントを再開する
+// サーバーが対応していない場合はErrNotSupportedを返す
+func (t *Client) ReopenInlineComment(commentID string) error {
+	return t.setInlineCommentResolved(commentID, false)
+}
+
+func (t *Client) setInlineCommentResolved(commentID string, resolved bool) error {
+	// REST APIには無いので、inline commentsプラグインのAPIを使う
+	err := t.rest.DoDecode(
+		http.MethodPut,
+		rest.Pathf("/rest/inlinecomments/1.0/comments/%s/resolve", commentID),
+		nil,
+		map[string]interface{}{
+			"resolved": resolved,
+		},
+		nil,
+	)
+	if rest.StatusCode(err) != http.StatusNotFound {
+		return err
+	}
+	// コメントが無くても404なので、コメントがあるのに404の時だけAPIが無いとみなす
+	cerr := t.rest.DoDecode(http.MethodGet, rest.Pathf("/rest/api/content/%s", commentID), nil, nil, nil)
+	if cerr != nil {
+		return cerr
+	}
+	return ErrNotSupported
+}
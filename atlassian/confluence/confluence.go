@@ -2,17 +2,14 @@ package confluence
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
 	"io"
-	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
-	"strconv"
 
+	"github.com/naminomare/gogutil/atlassian/rest"
 	"github.com/naminomare/gogutil/fileio"
 	"github.com/naminomare/gogutil/network"
 )
@@ -27,17 +24,22 @@ var (
 	// PageTypePage page
 	PageTypePage PageType = "page"
 
-	// PageTypeBlog blog
-	PageTypeBlog PageType = "blog"
+	// PageTypeBlog blogpost
+	PageTypeBlog PageType = "blogpost"
 
 	// ErrInvalidArguments 入力値が不正の時
 	ErrInvalidArguments = errors.New("入力値が不正です")
+
+	// ErrNotFound コンテンツが見つからない時
+	ErrNotFound = errors.New("コンテンツが見つかりません")
 )
 
+// ResponseError 2xx以外のレスポンスが返ってきた時のエラー
+type ResponseError = rest.ResponseError
+
 // Client コンフルアクセス用クライアント
 type Client struct {
-	baseURL    string
-	httpClient *network.HTTPWaitClient
+	rest *rest.Client
 }
 
 // NewClient クライアント作成
@@ -47,15 +49,31 @@ func NewClient(
 	userName,
 	password string,
 ) *Client {
-	ret := Client{
-		baseURL:    baseURL,
-		httpClient: network.NewHTTPWaitClient(1000, serverName),
+	return &Client{
+		rest: rest.NewBasicAuthClient(baseURL, serverName, userName, password),
+	}
+}
+
+// NewClientWithHTTPClient 設定済みのHTTPWaitClientを使ってクライアント作成
+func NewClientWithHTTPClient(baseURL string, httpClient *network.HTTPWaitClient) *Client {
+	return &Client{
+		rest: rest.NewClient(baseURL, httpClient),
 	}
-	ret.httpClient.SetAuth(userName, password)
-	return &ret
+}
+
+// HTTPClient 通信に使っているHTTPWaitClientを返す
+// プロキシやキャッシュなどの設定に使う
+func (t *Client) HTTPClient() *network.HTTPWaitClient {
+	return t.rest.HTTPClient()
+}
+
+// REST 通信に使っているrest.Clientを返す
+func (t *Client) REST() *rest.Client {
+	return t.rest
 }
 
 // CreateContent コンテンツ作成
+// pagetypeがPageTypeBlogの時、ancestorsIDは無視される
 func (t *Client) CreateContent(
 	spaceKey,
 	ancestorsID,
@@ -63,15 +81,9 @@ func (t *Client) CreateContent(
 	content string,
 	pagetype PageType,
 ) (*http.Response, error) {
-	targetURL := t.baseURL + "/rest/api/content"
 	postMap := map[string]interface{}{
 		"type":  pagetype,
 		"title": title,
-		"ancestors": []interface{}{
-			map[string]string{
-				"id": ancestorsID,
-			},
-		},
 		"space": map[string]string{
 			"key": spaceKey,
 		},
@@ -82,16 +94,15 @@ func (t *Client) CreateContent(
 			},
 		},
 	}
-	reader := toJSONReader(postMap)
-	resp, err := t.httpClient.DoRequest(
-		http.MethodPost,
-		targetURL,
-		reader,
-		map[string]string{
-			network.ContentType: network.ApplicationJSON,
-		},
-	)
-	return resp, err
+	// ブログ投稿は親を持てない
+	if pagetype != PageTypeBlog && ancestorsID != "" {
+		postMap["ancestors"] = []interface{}{
+			map[string]string{
+				"id": ancestorsID,
+			},
+		}
+	}
+	return t.rest.Do(http.MethodPost, "/rest/api/content", nil, postMap, nil)
 }
 
 // UpdateContent コンテンツのアップデートを行う
@@ -102,7 +113,6 @@ func (t *Client) UpdateContent(
 	newTitle string,
 	newContent string,
 ) (*http.Response, error) {
-	targetURL := t.baseURL + "/rest/api/content/" + contentID
 	nextVersion := currentVersion + 1
 
 	putMap := map[string]interface{}{
@@ -118,102 +128,63 @@ func (t *Client) UpdateContent(
 			},
 		},
 	}
-	reader := toJSONReader(putMap)
-	resp, err := t.httpClient.DoRequest(
-		http.MethodPut,
-		targetURL,
-		reader,
-		map[string]string{
-			network.ContentType: network.ApplicationJSON,
-		},
-	)
-	return resp, err
+	return t.rest.Do(http.MethodPut, rest.Pathf("/rest/api/content/%s", contentID), nil, putMap, nil)
 }
 
 // FetchPage ページ内容を取得する
 func (t *Client) FetchPage(
 	query map[string]string,
 ) (*http.Response, error) {
-	targetURL := t.baseURL + "/rest/api/content"
-	qStr := ""
+	q := url.Values{}
 	for k, v := range query {
-		if qStr != "" {
-			qStr += "&"
-		}
-		qStr += url.PathEscape(k) + "=" + url.PathEscape(v)
-	}
-	if qStr != "" {
-		targetURL += "?" + qStr
+		q.Set(k, v)
 	}
-
-	resp, err := t.httpClient.DoRequest(
-		http.MethodGet,
-		targetURL,
-		nil,
-		nil,
-	)
-	return resp, err
+	return t.rest.Do(http.MethodGet, "/rest/api/content", q, nil, nil)
 }
 
 // FetchPageByID IDでページを取得
 func (t *Client) FetchPageByID(ID string) (*http.Response, error) {
-	targetURL := t.baseURL + "/rest/api/content/" + ID
-	resp, err := t.httpClient.DoRequest(
-		http.MethodGet,
-		targetURL,
-		nil,
-		nil,
-	)
-	return resp, err
+	return t.rest.Do(http.MethodGet, rest.Pathf("/rest/api/content/%s", ID), nil, nil, nil)
 }
 
 // FetchContentByTitle タイトルでページのコンテンツを取得
 func (t *Client) FetchContentByTitle(spaceKey, title string) (*http.Response, error) {
-	targetURL := t.baseURL + "/rest/api/content?spaceKey=" + url.PathEscape(spaceKey) + "&title=" + url.PathEscape(title) + "&expand=body.storage,version"
-	resp, err := t.httpClient.DoRequest(
-		http.MethodGet,
-		targetURL,
-		nil,
-		nil,
-	)
-	return resp, err
+	query := url.Values{
+		"spaceKey": {spaceKey},
+		"title":    {title},
+		"expand":   {"body.storage,version"},
+	}
+	return t.rest.Do(http.MethodGet, "/rest/api/content", query, nil, nil)
+}
+
+// DeleteContent コンテンツを削除する
+func (t *Client) DeleteContent(contentID string) (*http.Response, error) {
+	return t.rest.Do(http.MethodDelete, rest.Pathf("/rest/api/content/%s", contentID), nil, nil, nil)
 }
 
 // MovePage ページの移動
 func (t *Client) MovePage(srcPageID, dstParentPageID string) (*http.Response, error) {
-	targetURL := t.baseURL + "/rest/api/content/" + srcPageID
-	resp, err := t.FetchPageByID(srcPageID)
+	var srcPage Content
+	err := t.rest.DoDecode(http.MethodGet, rest.Pathf("/rest/api/content/%s", srcPageID), nil, nil, &srcPage)
 	if err != nil {
 		return nil, err
 	}
-	srcPageMap, err := network.ResponseToMap(resp)
-	if err != nil {
-		return nil, err
-	}
-	newver := int(srcPageMap["version"].(map[string]interface{})["number"].(float64) + 1)
 	putMap := map[string]interface{}{
 		"version": map[string]interface{}{
-			"number": newver,
+			"number": srcPage.Version.Number + 1,
+		},
+		"type": srcPage.Type,
+		"space": map[string]string{
+			"key": srcPage.Space.Key,
 		},
-		"type":  srcPageMap["type"],
-		"space": srcPageMap["space"],
-		"title": srcPageMap["title"],
+		"title": srcPage.Title,
 		"ancestors": []map[string]interface{}{
 			map[string]interface{}{
 				"id": dstParentPageID,
 			},
 		},
 	}
-	reader := toJSONReader(putMap)
-	resp, err = t.httpClient.DoRequest(
-		http.MethodPut,
-		targetURL,
-		reader,
-		map[string]string{
-			network.ContentType: network.ApplicationJSON,
-		},
-	)
-	return resp, err
+	return t.rest.Do(http.MethodPut, rest.Pathf("/rest/api/content/%s", srcPageID), nil, putMap, nil)
 }
 
 // SearchPageByCQL ページを検索する
@@ -222,71 +193,79 @@ func (t *Client) SearchPageByCQL(
 	start int,
 	limit int,
 ) (*http.Response, error) {
-	targetURL := t.baseURL + "/rest/api/search"
-	query := map[string]string{}
+	query := url.Values{}
 	if cql != "" {
-		query["cql"] = cql
+		query.Set("cql", cql)
 	}
-	if start != 0 {
-		query["start"] = strconv.Itoa(start)
-	}
-	if limit != 0 {
-		query["limit"] = strconv.Itoa(limit)
-	}
-
-	if len(query) > 0 {
-		qStr := ""
-		for k, v := range query {
-			if qStr != "" {
-				qStr += "&"
-			}
-			qStr += url.PathEscape(k) + "=" + url.PathEscape(v)
-		}
-		targetURL += "?" + qStr
-	}
-
-	resp, err := t.httpClient.DoRequest(
-		http.MethodGet,
-		targetURL,
-		nil,
-		nil,
-	)
-	return resp, err
+	query = rest.SetPaging(query, "start", start, "limit", limit)
+	return t.rest.Do(http.MethodGet, "/rest/api/search", query, nil, nil)
 }
 
 // AddAttachments ページにファイルを添付する
+// ファイルは送りながら読むので、まとめてメモリに載せない
 func (t *Client) AddAttachments(pageID string, files []string) (*http.Response, error) {
-	var buf bytes.Buffer
-	w := multipart.NewWriter(&buf)
-
-	for _, file := range files {
-		fh, err := os.Open(file)
-		if err != nil {
-			return nil, err
-		}
-		defer fh.Close()
+	return t.addAttachmentFiles(pageID, files, files)
+}
 
-		fw, err := w.CreateFormFile("file", fileio.FileName(file))
-		if err != nil {
+// addAttachmentFiles pathsのファイルをnamesの名前で添付する
+// multipartのbodyはio.Pipeで作りながら送り、ファイルは書く直前に開いて書いたら閉じる
+func (t *Client) addAttachmentFiles(pageID string, paths, names []string) (*http.Response, error) {
+	if len(paths) != len(names) {
+		return nil, ErrInvalidArguments
+	}
+	// 途中で開けずにリクエストが切れないように、先に確認しておく
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
 			return nil, err
 		}
-		io.Copy(fw, fh)
 	}
-	w.Close()
 
-	targetURL := t.baseURL + "/rest/api/content/" + pageID + "/child/attachment"
-	resp, err := t.httpClient.DoRequest(
+	pr, pw := io.Pipe()
+	w := multipart.NewWriter(pw)
+	contentType := w.FormDataContentType()
+	go func() {
+		pw.CloseWithError(writeAttachmentFiles(w, paths, names))
+	}()
+	resp, err := t.rest.Do(
 		http.MethodPost,
-		targetURL,
-		&buf,
+		rest.Pathf("/rest/api/content/%s/child/attachment", pageID),
+		nil,
+		pr,
 		map[string]string{
-			network.ContentType: w.FormDataContentType(),
+			network.ContentType: contentType,
 			"X-Atlassian-Token": "no-check",
 		},
 	)
+	// bodyを読まれずに終わった時も書き込み側のgoroutineを止める
+	pr.Close()
 	return resp, err
 }
 
+func writeAttachmentFiles(w *multipart.Writer, paths, names []string) error {
+	for i, path := range paths {
+		err := writeAttachmentFile(w, path, names[i])
+		if err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+func writeAttachmentFile(w *multipart.Writer, path, name string) error {
+	fh, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	fw, err := w.CreateFormFile("file", fileio.FileName(name))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, fh)
+	return err
+}
+
 // AddAttachmentsByIO readerとそれに応じたfilenamesを使って書き込む
 // len(readers) != len(filenames) の時は ErrInvalidArgumentsを返す
 func (t *Client) AddAttachmentsByIO(pageID string, readers []io.Reader, filenames []string) (*http.Response, error) {
@@ -306,22 +285,46 @@ func (t *Client) AddAttachmentsByIO(pageID string, readers []io.Reader, filename
 	}
 	w.Close()
 
-	targetURL := t.baseURL + "/rest/api/content/" + pageID + "/child/attachment"
-	resp, err := t.httpClient.DoRequest(
+	return t.rest.Do(
 		http.MethodPost,
-		targetURL,
+		rest.Pathf("/rest/api/content/%s/child/attachment", pageID),
+		nil,
+		&buf,
+		map[string]string{
+			network.ContentType: w.FormDataContentType(),
+			"X-Atlassian-Token": "no-check",
+		},
+	)
+}
+
+// UpdateAttachmentData 添付ファイルを新しいバージョンで置き換える
+func (t *Client) UpdateAttachmentData(pageID, attachmentID, filename string, reader io.Reader) (*http.Response, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	fw, err := w.CreateFormFile("file", fileio.FileName(filename))
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(fw, reader)
+	if err != nil {
+		return nil, err
+	}
+	w.Close()
+
+	return t.rest.Do(
+		http.MethodPost,
+		rest.Pathf("/rest/api/content/%s/child/attachment/%s/data", pageID, attachmentID),
+		nil,
 		&buf,
 		map[string]string{
 			network.ContentType: w.FormDataContentType(),
 			"X-Atlassian-Token": "no-check",
 		},
 	)
-	return resp, err
 }
 
 // MoveAttachment pageIDのattachmentIDのattachmentをdstPageIDへ
 func (t *Client) MoveAttachment(pageID, attachmentID, dstPageID string) (*http.Response, error) {
-	targetURL := t.baseURL + "/rest/api/content/" + pageID + "/child/attachment/" + attachmentID
 	jsonObj := map[string]interface{}{
 		"id":     attachmentID,
 		"type":   "attachment",
@@ -334,29 +337,36 @@ func (t *Client) MoveAttachment(pageID, attachmentID, dstPageID string) (*http.R
 			"type": "attachment",
 		},
 	}
-	reader := toJSONReader(jsonObj)
-	resp, err := t.httpClient.DoRequest(
+	return t.rest.Do(
 		http.MethodPut,
-		targetURL,
-		reader,
+		rest.Pathf("/rest/api/content/%s/child/attachment/%s", pageID, attachmentID),
+		nil,
+		jsonObj,
 		map[string]string{
-			network.ContentType: network.ApplicationJSON,
 			"X-Atlassian-Token": "no-check",
 		},
 	)
-	return resp, err
 }
 
 // MoveAttachmentsFromPage fromPageIDに添付されているファイルをdstPageIDに移す
 func (t *Client) MoveAttachmentsFromPage(fromPageID, dstPageID string) ([]*http.Response, error) {
-	metadata, err := t.FetchAttachmentMetaData(fromPageID)
+	return t.MoveAttachmentsFromPageWithFilter(fromPageID, dstPageID, AttachmentFilter{})
+}
+
+// MoveAttachmentsFromPageWithFilter fromPageIDに添付されているファイルのうちfilterに一致するものをdstPageIDに移す
+func (t *Client) MoveAttachmentsFromPageWithFilter(fromPageID, dstPageID string, filter AttachmentFilter) ([]*http.Response, error) {
+	attachments, err := t.FetchAllAttachments(fromPageID)
 	if err != nil {
 		return nil, err
 	}
 	var ret []*http.Response
-	for _, v := range metadata.Results {
+	for _, v := range FilterAttachments(attachments, filter) {
 		resp, err := t.MoveAttachment(fromPageID, v.ID, dstPageID)
 		if err != nil {
+			// 返さないレスポンスは閉じておく
+			for _, r := range ret {
+				r.Body.Close()
+			}
 			return nil, err
 		}
 		ret = append(ret, resp)
@@ -366,76 +376,61 @@ func (t *Client) MoveAttachmentsFromPage(fromPageID, dstPageID string) ([]*http.
 
 // FetchAttachmentMetaData pageIDに添付されたファイルのデータを取得する
 func (t *Client) FetchAttachmentMetaData(pageID string) (*AttachmentResults, error) {
-	targetURL := t.baseURL + "/rest/api/content/" + pageID + "/child/attachment"
-	resp, err := t.httpClient.DoRequest(
+	var res AttachmentResults
+	err := t.rest.DoDecode(
 		http.MethodGet,
-		targetURL,
-		nil,
+		rest.Pathf("/rest/api/content/%s/child/attachment", pageID),
+		url.Values{"expand": {"version,metadata.labels"}},
 		nil,
+		&res,
 	)
 	if err != nil {
 		return nil, err
 	}
+	return &res, nil
+}
 
-	bin, err := ioutil.ReadAll(resp.Body)
-	defer resp.Body.Close()
-	if err != nil {
-		return nil, err
-	}
-
-	var res AttachmentResults
-	err = json.Unmarshal(bin, &res)
-
-	return &res, err
+// FetchAllAttachments pageIDに添付されたファイルをすべて取得する
+// FetchAttachmentMetaDataは最初のページしか返さないので、添付が多いページではこちらを使う
+func (t *Client) FetchAllAttachments(pageID string) ([]AttachmentFetchResult, error) {
+	return rest.FetchAll(0, func(start, limit int) ([]AttachmentFetchResult, bool, error) {
+		query := rest.SetPaging(url.Values{"expand": {"version,metadata.labels"}}, "start", start, "limit", limit)
+		var res AttachmentResults
+		err := t.rest.DoDecode(http.MethodGet, rest.Pathf("/rest/api/content/%s/child/attachment", pageID), query, nil, &res)
+		if err != nil {
+			return nil, false, err
+		}
+		return res.Results, res.Links["next"] != "", nil
+	})
 }
 
 // DownloadAttachmentsFromPage ページに添付してあるファイルをダウンロードする
+// 失敗したファイルがあった場合は最初のエラーを返す
 func (t *Client) DownloadAttachmentsFromPage(pageID, directory string) error {
-	res, err := t.FetchAttachmentMetaData(pageID)
+	results, err := t.DownloadAttachmentsWithOptions(pageID, directory, DownloadOptions{})
 	if err != nil {
 		return err
 	}
-
-	os.MkdirAll(directory, os.ModePerm)
-	for _, v := range res.Results {
-		downloadURL := t.baseURL + v.Links.Download
-		path, err := fileio.GetNonExistFileName(filepath.Join(directory, v.Title), 1000)
-		if err != nil {
-			return err
+	for _, r := range results {
+		if r.Err != nil {
+			return r.Err
 		}
-		t.DownloadFromURL(downloadURL, path)
 	}
 	return nil
 }
 
 // DownloadFromURL ダウンロードする
+// 一時ファイルに落としてから、成功した時だけoutputFilepathにリネームする
 func (t *Client) DownloadFromURL(url, outputFilepath string) error {
-	resp, err := t.httpClient.DoRequest(
-		http.MethodGet,
-		url,
-		nil,
-		nil,
-	)
+	partPath := outputFilepath + PartialFileExt
+	_, _, err := t.downloadToPartialFile(url, partPath, false)
 	if err != nil {
 		return err
 	}
-	fh, err := os.Create(outputFilepath)
-	if err != nil {
-		return err
-	}
-	defer fh.Close()
-	defer resp.Body.Close()
-	_, err = io.Copy(fh, resp.Body)
-
-	return err
+	return os.Rename(partPath, outputFilepath)
 }
 
-func toJSONReader(mapobj map[string]interface{}) *bytes.Reader {
-	bin, err := json.Marshal(mapobj)
-	if err != nil {
-		panic(err)
-	}
-	reader := bytes.NewReader(bin)
-
-	return reader
+// decodeResponse respのbodyをvにデコードする。2xx以外の時は*ResponseErrorを返す
+func decodeResponse(resp *http.Response, v interface{}) error {
+	return rest.DecodeResponse(resp, v)
 }
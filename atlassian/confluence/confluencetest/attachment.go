@@ -0,0 +1,183 @@
+package confluencetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+)
+
+func (t *Server) handleAttachment(w http.ResponseWriter, r *http.Request, page *content, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		var all []interface{}
+		for _, id := range t.order {
+			c := t.contents[id]
+			if c.typ == "attachment" && c.containerID == page.id {
+				all = append(all, t.toAttachment(c))
+			}
+		}
+		writeJSON(w, http.StatusOK, pageOf(r, all))
+	case len(parts) == 0 && r.Method == http.MethodPost:
+		t.uploadAttachments(w, r, page)
+	case len(parts) == 1 && r.Method == http.MethodPut:
+		t.moveAttachment(w, r, page, parts[0])
+	case len(parts) == 2 && parts[1] == "data" && r.Method == http.MethodPost:
+		t.updateAttachmentData(w, r, page, parts[0])
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (t *Server) attachmentOf(page *content, id string) (*content, bool) {
+	c, ok := t.contents[id]
+	if !ok || c.typ != "attachment" || c.containerID != page.id {
+		return nil, false
+	}
+	return c, true
+}
+
+func readFormFiles(r *http.Request) ([]*multipart.FileHeader, string, error) {
+	err := r.ParseMultipartForm(32 << 20)
+	if err != nil {
+		return nil, "", err
+	}
+	return r.MultipartForm.File["file"], r.FormValue("comment"), nil
+}
+
+func readFormFile(fh *multipart.FileHeader) ([]byte, string, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, "", err
+	}
+	mediaType := fh.Header.Get("Content-Type")
+	if mediaType == "" || mediaType == "application/octet-stream" {
+		if v := mime.TypeByExtension(filepath.Ext(fh.Filename)); v != "" {
+			mediaType = v
+		} else {
+			mediaType = http.DetectContentType(data)
+		}
+	}
+	return data, mediaType, nil
+}
+
+func (t *Server) uploadAttachments(w http.ResponseWriter, r *http.Request, page *content) {
+	if r.Header.Get("X-Atlassian-Token") != "no-check" {
+		writeError(w, http.StatusForbidden, "XSRF check failed")
+		return
+	}
+	files, comment, err := readFormFiles(r)
+	if err != nil || len(files) == 0 {
+		writeError(w, http.StatusBadRequest, "no file")
+		return
+	}
+	for _, fh := range files {
+		for _, id := range t.order {
+			c := t.contents[id]
+			if c.typ == "attachment" && c.containerID == page.id && c.current().title == fh.Filename {
+				writeError(w, http.StatusBadRequest,
+					"Cannot add a new attachment with same file name as an existing attachment: "+fh.Filename)
+				return
+			}
+		}
+	}
+
+	var results []interface{}
+	for _, fh := range files {
+		data, mediaType, err := readFormFile(fh)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		c := t.newContent("attachment", page.spaceKey, fh.Filename, "")
+		c.containerID = page.id
+		c.mediaType = mediaType
+		c.comment = comment
+		c.data = data
+		results = append(results, t.toAttachment(c))
+	}
+	writeJSON(w, http.StatusOK, pageOf(r, results))
+}
+
+func (t *Server) updateAttachmentData(w http.ResponseWriter, r *http.Request, page *content, id string) {
+	c, ok := t.attachmentOf(page, id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "attachment not found")
+		return
+	}
+	files, comment, err := readFormFiles(r)
+	if err != nil || len(files) != 1 {
+		writeError(w, http.StatusBadRequest, "exactly one file is required")
+		return
+	}
+	data, mediaType, err := readFormFile(files[0])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cur := c.current()
+	c.versions = append(c.versions, revision{
+		number: cur.number + 1,
+		title:  cur.title,
+		when:   t.Now(),
+	})
+	c.mediaType = mediaType
+	c.comment = comment
+	c.data = data
+	writeJSON(w, http.StatusOK, t.toAttachment(c))
+}
+
+func (t *Server) moveAttachment(w http.ResponseWriter, r *http.Request, page *content, id string) {
+	c, ok := t.attachmentOf(page, id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "attachment not found")
+		return
+	}
+	var req contentRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	dst, ok := t.contents[req.Container.ID]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "container not found")
+		return
+	}
+	c.containerID = dst.id
+	c.spaceKey = dst.spaceKey
+	if req.Title != "" {
+		cur := c.current()
+		c.versions = append(c.versions, revision{
+			number: cur.number + 1,
+			title:  req.Title,
+			when:   t.Now(),
+		})
+	}
+	writeJSON(w, http.StatusOK, t.toAttachment(c))
+}
+
+func (t *Server) handleDownload(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) != 2 || r.Method != http.MethodGet {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	for _, id := range t.order {
+		c := t.contents[id]
+		rev := c.current()
+		if c.typ == "attachment" && c.containerID == parts[0] && rev.title == parts[1] {
+			w.Header().Set("Content-Type", c.mediaType)
+			http.ServeContent(w, r, rev.title, rev.when, bytes.NewReader(c.data))
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "attachment not found")
+}
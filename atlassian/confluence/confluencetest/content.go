@@ -0,0 +1,363 @@
+package confluencetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/naminomare/gogutil/atlassian/confluence"
+)
+
+type idRequest struct {
+	ID string `json:"id"`
+}
+
+type contentRequest struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Space     spaceRequest `json:"space"`
+	Ancestors []idRequest  `json:"ancestors"`
+	Container idRequest    `json:"container"`
+	Version   struct {
+		Number  int    `json:"number"`
+		Message string `json:"message"`
+	} `json:"version"`
+	Body *struct {
+		Storage struct {
+			Value string `json:"value"`
+		} `json:"storage"`
+	} `json:"body"`
+}
+
+type spaceRequest struct {
+	Key string `json:"key"`
+}
+
+func decodeContentRequest(r *http.Request) (*contentRequest, error) {
+	var ret contentRequest
+	err := json.NewDecoder(r.Body).Decode(&ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+func (t *Server) handleContentRoot(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		typ := q.Get("type")
+		if typ == "" {
+			typ = string(confluence.PageTypePage)
+		}
+		var all []interface{}
+		for _, id := range t.order {
+			c := t.contents[id]
+			rev := c.current()
+			if c.typ != typ {
+				continue
+			}
+			if v := q.Get("spaceKey"); v != "" && c.spaceKey != v {
+				continue
+			}
+			if v := q.Get("title"); v != "" && rev.title != v {
+				continue
+			}
+			if v := q.Get("postingDay"); v != "" && c.versions[0].when.Format(confluence.PostingDayFormat) != v {
+				continue
+			}
+			all = append(all, t.toContent(c, rev))
+		}
+		writeJSON(w, http.StatusOK, pageOf(r, all))
+	case http.MethodPost:
+		t.createContent(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (t *Server) createContent(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeContentRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	spaceKey := req.Space.Key
+	body := ""
+	if req.Body != nil {
+		body = req.Body.Storage.Value
+	}
+
+	switch req.Type {
+	case string(confluence.PageTypePage), string(confluence.PageTypeBlog):
+		if req.Title == "" || spaceKey == "" {
+			writeError(w, http.StatusBadRequest, "title and space are required")
+			return
+		}
+		if req.Type == string(confluence.PageTypeBlog) && len(req.Ancestors) > 0 {
+			writeError(w, http.StatusBadRequest, "blog posts cannot have ancestors")
+			return
+		}
+		if t.findByTitle(spaceKey, req.Type, req.Title) != nil {
+			writeError(w, http.StatusBadRequest, "A page with this title already exists")
+			return
+		}
+		parentID := ""
+		if len(req.Ancestors) > 0 {
+			parentID = req.Ancestors[len(req.Ancestors)-1].ID
+			if _, ok := t.contents[parentID]; !ok {
+				writeError(w, http.StatusBadRequest, "ancestor not found")
+				return
+			}
+		}
+		c := t.newContent(req.Type, spaceKey, req.Title, body)
+		c.parentID = parentID
+		writeJSON(w, http.StatusOK, t.toContent(c, c.current()))
+	case "comment":
+		container, ok := t.contents[req.Container.ID]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "container not found")
+			return
+		}
+		c := t.newContent("comment", container.spaceKey, "Re: "+container.current().title, body)
+		c.containerID = container.id
+		if len(req.Ancestors) > 0 {
+			c.parentID = req.Ancestors[len(req.Ancestors)-1].ID
+		}
+		writeJSON(w, http.StatusOK, t.toContent(c, c.current()))
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported type: "+req.Type)
+	}
+}
+
+func (t *Server) handleContent(w http.ResponseWriter, r *http.Request, parts []string) {
+	c, ok := t.contents[parts[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "No content found with id: "+parts[0])
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		t.handleContentByID(w, r, c)
+	case len(parts) >= 3 && parts[1] == "child" && parts[2] == "attachment":
+		t.handleAttachment(w, r, c, parts[3:])
+	case len(parts) == 3 && parts[1] == "child":
+		t.handleChildren(w, r, c, parts[2])
+	case parts[1] == "label":
+		t.handleLabel(w, r, c, parts[2:])
+	case len(parts) == 2 && parts[1] == "version":
+		t.handleVersion(w, r, c)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (t *Server) handleExperimentalContent(w http.ResponseWriter, r *http.Request, parts []string) {
+	c, ok := t.contents[parts[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "No content found with id: "+parts[0])
+		return
+	}
+	if len(parts) == 2 && parts[1] == "version" {
+		t.handleVersion(w, r, c)
+		return
+	}
+	writeError(w, http.StatusNotFound, "not found")
+}
+
+func (t *Server) handleContentByID(w http.ResponseWriter, r *http.Request, c *content) {
+	switch r.Method {
+	case http.MethodGet:
+		rev := c.current()
+		if v := r.URL.Query().Get("version"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || len(c.versions) < n {
+				writeError(w, http.StatusNotFound, "version not found")
+				return
+			}
+			rev = c.versions[n-1]
+		}
+		writeJSON(w, http.StatusOK, t.toContent(c, rev))
+	case http.MethodPut:
+		t.updateContent(w, r, c)
+	case http.MethodDelete:
+		t.deleteContent(c.id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (t *Server) updateContent(w http.ResponseWriter, r *http.Request, c *content) {
+	req, err := decodeContentRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cur := c.current()
+	if req.Version.Number != cur.number+1 {
+		writeError(w, http.StatusConflict,
+			"Version must be incremented on update. Current version is: "+strconv.Itoa(cur.number))
+		return
+	}
+
+	if len(req.Ancestors) > 0 {
+		parentID := req.Ancestors[len(req.Ancestors)-1].ID
+		parent, ok := t.contents[parentID]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "ancestor not found")
+			return
+		}
+		if parent == c {
+			writeError(w, http.StatusBadRequest, "cannot move a page under itself")
+			return
+		}
+		for _, a := range t.ancestors(parent) {
+			if a == c {
+				writeError(w, http.StatusBadRequest, "cannot move a page under its descendant")
+				return
+			}
+		}
+		c.parentID = parentID
+	}
+
+	next := revision{
+		number:  cur.number + 1,
+		title:   cur.title,
+		body:    cur.body,
+		message: req.Version.Message,
+		when:    t.Now(),
+	}
+	if req.Title != "" {
+		next.title = req.Title
+	}
+	if req.Body != nil {
+		next.body = req.Body.Storage.Value
+	}
+	c.versions = append(c.versions, next)
+	writeJSON(w, http.StatusOK, t.toContent(c, next))
+}
+
+func (t *Server) handleChildren(w http.ResponseWriter, r *http.Request, c *content, childType string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var all []interface{}
+	for _, id := range t.order {
+		child := t.contents[id]
+		switch childType {
+		case "page":
+			if child.typ == string(confluence.PageTypePage) && child.parentID == c.id {
+				all = append(all, t.toContent(child, child.current()))
+			}
+		case "comment":
+			if child.typ == "comment" && child.containerID == c.id {
+				all = append(all, t.toComment(child))
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, pageOf(r, all))
+}
+
+func (t *Server) toComment(c *content) confluence.Comment {
+	cont := t.toContent(c, c.current())
+	ret := confluence.Comment{
+		ID:        cont.ID,
+		Type:      cont.Type,
+		Status:    cont.Status,
+		Title:     cont.Title,
+		Version:   cont.Version,
+		Body:      cont.Body,
+		Ancestors: cont.Ancestors,
+		Links:     cont.Links,
+	}
+	if container, ok := t.contents[c.containerID]; ok {
+		ret.Container = t.toContent(container, container.current())
+	}
+	ret.Extensions.Location = string(confluence.CommentLocationFooter)
+	return ret
+}
+
+func (t *Server) handleLabel(w http.ResponseWriter, r *http.Request, c *content, parts []string) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, pageOf(r, labelsOf(c)))
+	case http.MethodPost:
+		var req []struct {
+			Prefix string `json:"prefix"`
+			Name   string `json:"name"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		for _, v := range req {
+			c.addLabel(v.Name)
+		}
+		writeJSON(w, http.StatusOK, pageOf(r, labelsOf(c)))
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if len(parts) > 0 {
+			name = parts[0]
+		}
+		if !c.removeLabel(name) {
+			writeError(w, http.StatusNotFound, "label not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func labelsOf(c *content) []interface{} {
+	var ret []interface{}
+	for _, l := range c.labels {
+		ret = append(ret, map[string]string{"prefix": "global", "name": l, "id": l})
+	}
+	return ret
+}
+
+func (t *Server) handleVersion(w http.ResponseWriter, r *http.Request, c *content) {
+	switch r.Method {
+	case http.MethodGet:
+		var all []interface{}
+		for i := len(c.versions) - 1; i >= 0; i-- {
+			all = append(all, t.toContent(c, c.versions[i]).Version)
+		}
+		writeJSON(w, http.StatusOK, pageOf(r, all))
+	case http.MethodPost:
+		var req struct {
+			OperationKey string `json:"operationKey"`
+			Params       struct {
+				VersionNumber int    `json:"versionNumber"`
+				Message       string `json:"message"`
+			} `json:"params"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.OperationKey != "restore" {
+			writeError(w, http.StatusBadRequest, "unsupported operation")
+			return
+		}
+		n := req.Params.VersionNumber
+		if n < 1 || len(c.versions) < n {
+			writeError(w, http.StatusNotFound, "version not found")
+			return
+		}
+		src := c.versions[n-1]
+		next := revision{
+			number:  c.current().number + 1,
+			title:   src.title,
+			body:    src.body,
+			message: req.Params.Message,
+			when:    t.Now(),
+		}
+		c.versions = append(c.versions, next)
+		writeJSON(w, http.StatusOK, t.toContent(c, next).Version)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
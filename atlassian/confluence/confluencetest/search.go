@@ -0,0 +1,436 @@
+package confluencetest
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	errInvalidCQL = errors.New("could not parse cql")
+
+	cqlDateFormats = []string{
+		"2006-01-02 15:04",
+		"2006/01/02 15:04",
+		"2006-01-02",
+		"2006/01/02",
+		time.RFC3339,
+	}
+)
+
+// cqlClause field op values
+type cqlClause struct {
+	field  string
+	op     string
+	values []string
+}
+
+// cqlExpr 条件の木。opが空の時はclause、それ以外はchildrenをand, or, notでつなぐ
+type cqlExpr struct {
+	op       string
+	children []*cqlExpr
+	clause   cqlClause
+}
+
+// cqlQuery 条件とorder by。exprがnilの時はすべて一致する
+type cqlQuery struct {
+	expr    *cqlExpr
+	orderBy string
+	desc    bool
+}
+
+func (t *Server) handleSearch(w http.ResponseWriter, r *http.Request, wrapResult bool) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query, err := parseCQL(r.URL.Query().Get("cql"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var matched []*content
+	for _, id := range t.order {
+		c := t.contents[id]
+		ok, err := t.matchCQL(c, query)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if ok {
+			matched = append(matched, c)
+		}
+	}
+	if query.orderBy != "" {
+		sort.SliceStable(matched, func(i, j int) bool {
+			if query.desc {
+				return t.cqlLess(matched[j], matched[i], query.orderBy)
+			}
+			return t.cqlLess(matched[i], matched[j], query.orderBy)
+		})
+	}
+
+	var all []interface{}
+	for _, c := range matched {
+		cont := t.toContent(c, c.current())
+		if !wrapResult {
+			all = append(all, cont)
+			continue
+		}
+		all = append(all, map[string]interface{}{
+			"content":      cont,
+			"title":        cont.Title,
+			"excerpt":      "",
+			"url":          cont.Links["webui"],
+			"lastModified": cont.Version.When,
+			"entityType":   "content",
+		})
+	}
+	writeJSON(w, http.StatusOK, pageOf(r, all))
+}
+
+func (t *Server) cqlLess(a, b *content, field string) bool {
+	switch field {
+	case "created":
+		return a.versions[0].when.Before(b.versions[0].when)
+	case "lastmodified":
+		return a.current().when.Before(b.current().when)
+	case "title":
+		return a.current().title < b.current().title
+	}
+	return a.id < b.id
+}
+
+func (t *Server) matchCQL(c *content, query *cqlQuery) (bool, error) {
+	if query.expr == nil {
+		return true, nil
+	}
+	return t.matchExpr(c, query.expr)
+}
+
+func (t *Server) matchExpr(c *content, expr *cqlExpr) (bool, error) {
+	switch expr.op {
+	case "and", "or":
+		// andは1つでも合わなければ、orは1つでも合えば決まる
+		decided := expr.op == "or"
+		for _, child := range expr.children {
+			ok, err := t.matchExpr(c, child)
+			if err != nil {
+				return false, err
+			}
+			if ok == decided {
+				return decided, nil
+			}
+		}
+		return !decided, nil
+	case "not":
+		ok, err := t.matchExpr(c, expr.children[0])
+		return !ok, err
+	}
+	return t.matchClause(c, expr.clause)
+}
+
+func (t *Server) matchClause(c *content, clause cqlClause) (bool, error) {
+	rev := c.current()
+	var actual []string
+	switch clause.field {
+	case "type":
+		actual = []string{c.typ}
+	case "space":
+		actual = []string{c.spaceKey}
+	case "id", "content":
+		actual = []string{c.id}
+	case "title":
+		actual = []string{rev.title}
+	case "text":
+		actual = []string{rev.title, rev.body}
+	case "parent":
+		actual = []string{c.parentID}
+	case "ancestor":
+		for _, a := range t.ancestors(c) {
+			actual = append(actual, a.id)
+		}
+	case "label":
+		actual = c.labels
+	case "created", "lastmodified":
+		return matchTime(c, clause)
+	default:
+		return false, errors.New("unsupported cql field: " + clause.field)
+	}
+
+	switch clause.op {
+	case "=", "in":
+		return anyEqual(actual, clause.values), nil
+	case "!=", "not in":
+		return !anyEqual(actual, clause.values), nil
+	case "~":
+		return anyContains(actual, clause.values[0]), nil
+	case "!~":
+		return !anyContains(actual, clause.values[0]), nil
+	}
+	return false, errors.New("unsupported cql operator for " + clause.field + ": " + clause.op)
+}
+
+func matchTime(c *content, clause cqlClause) (bool, error) {
+	actual := c.current().when
+	if clause.field == "created" {
+		actual = c.versions[0].when
+	}
+	expected, err := parseCQLTime(clause.values[0], actual.Location())
+	if err != nil {
+		return false, err
+	}
+	// CQLの日付は分の精度
+	actual = actual.Truncate(time.Minute)
+	switch clause.op {
+	case "=":
+		return actual.Equal(expected), nil
+	case "!=":
+		return !actual.Equal(expected), nil
+	case ">":
+		return actual.After(expected), nil
+	case ">=":
+		return !actual.Before(expected), nil
+	case "<":
+		return actual.Before(expected), nil
+	case "<=":
+		return !actual.After(expected), nil
+	}
+	return false, errors.New("unsupported cql operator for " + clause.field + ": " + clause.op)
+}
+
+func parseCQLTime(value string, loc *time.Location) (time.Time, error) {
+	for _, f := range cqlDateFormats {
+		if v, err := time.ParseInLocation(f, value, loc); err == nil {
+			return v, nil
+		}
+	}
+	return time.Time{}, errors.New("could not parse date: " + value)
+}
+
+func anyEqual(actual, expected []string) bool {
+	for _, a := range actual {
+		for _, e := range expected {
+			if a == e {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func anyContains(actual []string, expected string) bool {
+	expected = strings.ToLower(strings.Trim(expected, "*"))
+	for _, a := range actual {
+		if strings.Contains(strings.ToLower(a), expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCQL 再帰下降で読む。優先順位はnot, and, orの順
+//
+//	query  = [or] ["order" "by" field ["asc" | "desc"]]
+//	or     = and {"or" and}
+//	and    = not {"and" not}
+//	not    = "not" not | "(" or ")" | clause
+func parseCQL(cql string) (*cqlQuery, error) {
+	tokens, err := tokenizeCQL(cql)
+	if err != nil {
+		return nil, err
+	}
+	p := &cqlParser{tokens: tokens}
+	ret := &cqlQuery{}
+	if !p.done() && p.peek() != "order" {
+		ret.expr, err = p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.peek() == "order" {
+		p.next()
+		if p.next() != "by" || p.done() {
+			return nil, errInvalidCQL
+		}
+		ret.orderBy = p.next()
+		switch p.peek() {
+		case "asc":
+			p.next()
+		case "desc":
+			p.next()
+			ret.desc = true
+		}
+	}
+	if !p.done() {
+		return nil, errInvalidCQL
+	}
+	return ret, nil
+}
+
+// cqlParser tokensをposから読む
+type cqlParser struct {
+	tokens []string
+	pos    int
+}
+
+func (t *cqlParser) done() bool {
+	return t.pos >= len(t.tokens)
+}
+
+// peek 次のトークンを小文字で返す。値の大文字小文字が要る時はrawを使う
+func (t *cqlParser) peek() string {
+	if t.done() {
+		return ""
+	}
+	return strings.ToLower(t.tokens[t.pos])
+}
+
+func (t *cqlParser) raw() string {
+	if t.done() {
+		return ""
+	}
+	return t.tokens[t.pos]
+}
+
+func (t *cqlParser) next() string {
+	ret := t.peek()
+	t.pos++
+	return ret
+}
+
+func (t *cqlParser) parseOr() (*cqlExpr, error) {
+	return t.parseBinary("or", t.parseAnd)
+}
+
+func (t *cqlParser) parseAnd() (*cqlExpr, error) {
+	return t.parseBinary("and", t.parseNot)
+}
+
+func (t *cqlParser) parseBinary(op string, operand func() (*cqlExpr, error)) (*cqlExpr, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	ret := &cqlExpr{op: op, children: []*cqlExpr{first}}
+	for t.peek() == op {
+		t.next()
+		child, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		ret.children = append(ret.children, child)
+	}
+	if len(ret.children) == 1 {
+		return first, nil
+	}
+	return ret, nil
+}
+
+func (t *cqlParser) parseNot() (*cqlExpr, error) {
+	switch t.peek() {
+	case "not":
+		t.next()
+		child, err := t.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &cqlExpr{op: "not", children: []*cqlExpr{child}}, nil
+	case "(":
+		t.next()
+		ret, err := t.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t.next() != ")" {
+			return nil, errInvalidCQL
+		}
+		return ret, nil
+	}
+	clause, err := t.parseClause()
+	if err != nil {
+		return nil, err
+	}
+	return &cqlExpr{clause: clause}, nil
+}
+
+func (t *cqlParser) parseClause() (cqlClause, error) {
+	switch t.peek() {
+	case "", "and", "or", "not", "order", "(", ")", ",":
+		return cqlClause{}, errInvalidCQL
+	}
+	clause := cqlClause{field: t.next(), op: t.next()}
+	if clause.op == "not" && t.peek() == "in" {
+		t.next()
+		clause.op = "not in"
+	}
+	if clause.op != "in" && clause.op != "not in" {
+		if t.done() {
+			return cqlClause{}, errInvalidCQL
+		}
+		clause.values = []string{t.raw()}
+		t.pos++
+		return clause, nil
+	}
+	if t.next() != "(" {
+		return cqlClause{}, errInvalidCQL
+	}
+	for !t.done() && t.peek() != ")" {
+		if t.peek() != "," {
+			clause.values = append(clause.values, t.raw())
+		}
+		t.pos++
+	}
+	if t.next() != ")" {
+		return cqlClause{}, errInvalidCQL
+	}
+	return clause, nil
+}
+
+func tokenizeCQL(cql string) ([]string, error) {
+	var ret []string
+	const opChars = "=!~<>"
+	for i := 0; i < len(cql); {
+		ch := cql[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			i++
+		case ch == '"' || ch == '\'':
+			// \でエスケープされた文字はそのまま値にする
+			value := strings.Builder{}
+			j := i + 1
+			for ; j < len(cql) && cql[j] != ch; j++ {
+				if cql[j] == '\\' && j+1 < len(cql) {
+					j++
+				}
+				value.WriteByte(cql[j])
+			}
+			if j >= len(cql) {
+				return nil, errInvalidCQL
+			}
+			ret = append(ret, value.String())
+			i = j + 1
+		case ch == '(' || ch == ')' || ch == ',':
+			ret = append(ret, string(ch))
+			i++
+		case strings.IndexByte(opChars, ch) >= 0:
+			j := i
+			for j < len(cql) && strings.IndexByte(opChars, cql[j]) >= 0 {
+				j++
+			}
+			ret = append(ret, cql[i:j])
+			i = j
+		default:
+			j := i
+			for j < len(cql) && strings.IndexByte(opChars+" \t\n\"'(),", cql[j]) < 0 {
+				j++
+			}
+			ret = append(ret, cql[i:j])
+			i = j
+		}
+	}
+	return ret, nil
+}
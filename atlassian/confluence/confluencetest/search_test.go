@@ -0,0 +1,126 @@
+package confluencetest
+
+import (
+	"strings"
+	"testing"
+)
+
+// exprString 木をS式にする。比較しやすいように
+func exprString(expr *cqlExpr) string {
+	if expr == nil {
+		return ""
+	}
+	if expr.op == "" {
+		return expr.clause.field + " " + expr.clause.op + " [" + strings.Join(expr.clause.values, "|") + "]"
+	}
+	var children []string
+	for _, c := range expr.children {
+		children = append(children, "("+exprString(c)+")")
+	}
+	return expr.op + " " + strings.Join(children, " ")
+}
+
+func TestParseCQL(t *testing.T) {
+	tests := []struct {
+		cql     string
+		want    string
+		orderBy string
+		desc    bool
+	}{
+		{cql: ``, want: ``},
+		{cql: `type = page`, want: `type = [page]`},
+		{cql: `space = "DS" and title ~ "a"`, want: `and (space = [DS]) (title ~ [a])`},
+		// andはorより強い
+		{cql: `a = 1 or b = 2 and c = 3`, want: `or (a = [1]) (and (b = [2]) (c = [3]))`},
+		{cql: `a = 1 and b = 2 or c = 3`, want: `or (and (a = [1]) (b = [2])) (c = [3])`},
+		{cql: `a = 1 and (b = 2 or c = 3)`, want: `and (a = [1]) (or (b = [2]) (c = [3]))`},
+		{cql: `((a = 1))`, want: `a = [1]`},
+		{cql: `not a = 1 and b = 2`, want: `and (not (a = [1])) (b = [2])`},
+		{cql: `not (a = 1 or b = 2)`, want: `not (or (a = [1]) (b = [2]))`},
+		{cql: `A = 1 OR B = 2`, want: `or (a = [1]) (b = [2])`},
+		{cql: `label in (x, "y z")`, want: `label in [x|y z]`},
+		{cql: `label not in ("x")`, want: `label not in [x]`},
+		{cql: `title = "say \"hi\" \\ bye"`, want: `title = [say "hi" \ bye]`},
+		{cql: `title = 'it\'s'`, want: `title = [it's]`},
+		{cql: `created >= "2026-01-01 10:00"`, want: `created >= [2026-01-01 10:00]`},
+		{cql: `type = page order by lastmodified desc`, want: `type = [page]`, orderBy: "lastmodified", desc: true},
+		{cql: `type = page order by title asc`, want: `type = [page]`, orderBy: "title"},
+		{cql: `order by created`, want: ``, orderBy: "created"},
+	}
+	for _, tt := range tests {
+		query, err := parseCQL(tt.cql)
+		if err != nil {
+			t.Fatalf("parseCQL(%q): %v", tt.cql, err)
+		}
+		if got := exprString(query.expr); got != tt.want {
+			t.Errorf("parseCQL(%q) = %q, want %q", tt.cql, got, tt.want)
+		}
+		if query.orderBy != tt.orderBy || query.desc != tt.desc {
+			t.Errorf("parseCQL(%q) order by %q desc=%v, want %q desc=%v", tt.cql, query.orderBy, query.desc, tt.orderBy, tt.desc)
+		}
+	}
+}
+
+func TestParseCQLInvalid(t *testing.T) {
+	for _, cql := range []string{
+		`and`,
+		`a = 1 and`,
+		`a = 1 or`,
+		`a =`,
+		`(a = 1`,
+		`a = 1)`,
+		`()`,
+		`not`,
+		`a = 1 b = 2`,
+		`label in x`,
+		`label in (x`,
+		`title = "unterminated`,
+		`a = 1 order`,
+		`a = 1 order title`,
+		`a = 1 order by`,
+		`a = 1 order by title desc extra`,
+	} {
+		if _, err := parseCQL(cql); err != errInvalidCQL {
+			t.Errorf("parseCQL(%q) error = %v, want errInvalidCQL", cql, err)
+		}
+	}
+}
+
+func TestMatchCQL(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	a := srv.AddPage("DS", "", "A", "a")
+	b := srv.AddPage("DS", "", "B", "b")
+	c := srv.AddPage("OT", "", "A", "c")
+
+	tests := []struct {
+		cql  string
+		want []string
+	}{
+		{`space = "DS" and (title = "A" or title = "B")`, []string{a, b}},
+		{`space = "OT" and (title = "A" or title = "B")`, []string{c}},
+		{`title = "B" or title = "A" and space = "OT"`, []string{b, c}},
+		{`not space = "DS"`, []string{c}},
+		{`space = "DS" and not title in ("A")`, []string{b}},
+		{`space not in ("DS", "OT")`, nil},
+	}
+	for _, tt := range tests {
+		query, err := parseCQL(tt.cql)
+		if err != nil {
+			t.Fatalf("parseCQL(%q): %v", tt.cql, err)
+		}
+		var got []string
+		for _, id := range []string{a, b, c} {
+			ok, err := srv.matchCQL(srv.contents[id], query)
+			if err != nil {
+				t.Fatalf("matchCQL(%q): %v", tt.cql, err)
+			}
+			if ok {
+				got = append(got, id)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s matched %v, want %v", tt.cql, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package confluencetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/naminomare/gogutil/atlassian/confluence"
+	"github.com/naminomare/gogutil/network"
+)
+
+var (
+	// DefaultUsername NewClientで使うユーザー名
+	DefaultUsername = "admin"
+
+	// DefaultPassword NewClientで使うパスワード
+	DefaultPassword = "admin"
+
+	// DefaultLimit limit未指定の時の件数
+	DefaultLimit = 25
+)
+
+// Failure 注入する失敗
+type Failure struct {
+	// Method 空の場合はすべてのメソッド
+	Method string
+	// PathPrefix 空の場合はすべてのパス
+	PathPrefix string
+	// StatusCode 返すステータスコード
+	StatusCode int
+	// Times 失敗させる回数。0の場合は外すまでずっと
+	Times int
+	// RetryAfter 空でなければRetry-Afterヘッダを付ける
+	RetryAfter string
+}
+
+// Server httptestを使ったConfluenceのフェイク
+// content, search, attachment, label, version, applinkのエンドポイントをメモリ上で再現する
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	nextID   int
+	contents map[string]*content
+	// order 作成順のID
+	order    []string
+	failures []*Failure
+	requests int
+	username string
+	password string
+	appLinks []confluence.ApplicationLink
+
+	// Now 時刻。テストで固定したい時に差し替える
+	Now func() time.Time
+}
+
+type content struct {
+	id          string
+	typ         string
+	spaceKey    string
+	parentID    string
+	containerID string
+	labels      []string
+	versions    []revision
+
+	// 添付ファイルの場合
+	mediaType string
+	comment   string
+	data      []byte
+}
+
+type revision struct {
+	number  int
+	title   string
+	body    string
+	message string
+	when    time.Time
+}
+
+// NewServer フェイクサーバーを起動する
+// DefaultUsername, DefaultPasswordのBasic認証を要求する
+func NewServer() *Server {
+	ret := &Server{
+		nextID:   1000,
+		contents: map[string]*content{},
+		username: DefaultUsername,
+		password: DefaultPassword,
+		Now:      time.Now,
+	}
+	ret.Server = httptest.NewServer(http.HandlerFunc(ret.serveHTTP))
+	return ret
+}
+
+// NewClient サーバーに向いたクライアントを返す
+// テストが遅くならないようにリクエスト間の待ち時間は0
+func (t *Server) NewClient() *confluence.Client {
+	httpClient := network.NewHTTPWaitClient(0, "")
+	httpClient.SetAuth(t.username, t.password)
+	return confluence.NewClientWithHTTPClient(t.URL, httpClient)
+}
+
+// SetAuth 要求する認証情報を変える。usernameが空の場合は認証しない
+func (t *Server) SetAuth(username, password string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.username = username
+	t.password = password
+}
+
+// InjectFailure 条件に一致するリクエストを失敗させる
+func (t *Server) InjectFailure(f Failure) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failures = append(t.failures, &f)
+}
+
+// ClearFailures 注入した失敗をすべて外す
+func (t *Server) ClearFailures() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failures = nil
+}
+
+// RequestCount 受け付けたリクエスト数
+func (t *Server) RequestCount() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.requests
+}
+
+// AddPage ページを作成してIDを返す
+func (t *Server) AddPage(spaceKey, parentID, title, body string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := t.newContent(string(confluence.PageTypePage), spaceKey, title, body)
+	c.parentID = parentID
+	return c.id
+}
+
+// AddAttachment ページにファイルを添付してIDを返す
+func (t *Server) AddAttachment(pageID, title, mediaType string, data []byte) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := t.newContent("attachment", t.spaceKeyOf(pageID), title, "")
+	c.containerID = pageID
+	c.mediaType = mediaType
+	c.data = data
+	return c.id
+}
+
+// AddLabel コンテンツにラベルを付ける
+func (t *Server) AddLabel(contentID, label string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.contents[contentID]; ok {
+		c.addLabel(label)
+	}
+}
+
+// AddApplicationLink アプリケーションリンクを追加してIDを返す
+// typeIDはconfluence.ApplicationTypeJiraなど
+func (t *Server) AddApplicationLink(name, typeID, displayURL string, primary bool) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := "applink-" + strconv.Itoa(t.nextID)
+	t.nextID++
+	t.appLinks = append(t.appLinks, confluence.ApplicationLink{
+		ID:         id,
+		Name:       name,
+		TypeID:     typeID,
+		DisplayURL: displayURL,
+		RPCURL:     displayURL,
+		IsPrimary:  primary,
+	})
+	return id
+}
+
+// Content コンテンツの現在の状態を返す
+func (t *Server) Content(id string) (confluence.Content, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.contents[id]
+	if !ok {
+		return confluence.Content{}, false
+	}
+	return t.toContent(c, c.current()), true
+}
+
+// AttachmentData 添付ファイルの中身を返す
+func (t *Server) AttachmentData(id string) ([]byte, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.contents[id]
+	if !ok || c.typ != "attachment" {
+		return nil, false
+	}
+	return append([]byte(nil), c.data...), true
+}
+
+func (t *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.requests++
+
+	if f := t.matchFailure(r); f != nil {
+		if f.RetryAfter != "" {
+			w.Header().Set("Retry-After", f.RetryAfter)
+		}
+		writeError(w, f.StatusCode, "injected failure")
+		return
+	}
+	if t.username != "" {
+		u, p, ok := r.BasicAuth()
+		if !ok || u != t.username || p != t.password {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+	}
+
+	path := r.URL.Path
+	switch {
+	case path == "/rest/api/search":
+		t.handleSearch(w, r, true)
+	case path == "/rest/api/content/search":
+		t.handleSearch(w, r, false)
+	case path == "/rest/api/content":
+		t.handleContentRoot(w, r)
+	case strings.HasPrefix(path, "/rest/api/content/"):
+		t.handleContent(w, r, splitPath(path[len("/rest/api/content/"):]))
+	case strings.HasPrefix(path, "/rest/experimental/content/"):
+		t.handleExperimentalContent(w, r, splitPath(path[len("/rest/experimental/content/"):]))
+	case strings.HasPrefix(path, "/download/attachments/"):
+		t.handleDownload(w, r, splitPath(path[len("/download/attachments/"):]))
+	case path == "/rest/applinks/1.0/applicationlink" && r.Method == http.MethodGet:
+		links := append([]confluence.ApplicationLink{}, t.appLinks...)
+		writeJSON(w, http.StatusOK, confluence.ApplicationLinkResults{ApplicationLinks: links})
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (t *Server) matchFailure(r *http.Request) *Failure {
+	for i, f := range t.failures {
+		if f.Method != "" && f.Method != r.Method {
+			continue
+		}
+		if !strings.HasPrefix(r.URL.Path, f.PathPrefix) {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				t.failures = append(t.failures[:i], t.failures[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+func (t *Server) newContent(typ, spaceKey, title, body string) *content {
+	t.nextID++
+	c := &content{
+		id:       strconv.Itoa(t.nextID),
+		typ:      typ,
+		spaceKey: spaceKey,
+		versions: []revision{{
+			number: 1,
+			title:  title,
+			body:   body,
+			when:   t.Now(),
+		}},
+	}
+	t.contents[c.id] = c
+	t.order = append(t.order, c.id)
+	return c
+}
+
+func (t *Server) deleteContent(id string) {
+	delete(t.contents, id)
+	for i, v := range t.order {
+		if v == id {
+			t.order = append(t.order[:i], t.order[i+1:]...)
+			break
+		}
+	}
+	// 子供と添付ファイルも消える
+	for _, v := range append([]string(nil), t.order...) {
+		c, ok := t.contents[v]
+		if !ok {
+			continue
+		}
+		if c.parentID == id || c.containerID == id {
+			t.deleteContent(v)
+		}
+	}
+}
+
+func (t *Server) spaceKeyOf(id string) string {
+	if c, ok := t.contents[id]; ok {
+		return c.spaceKey
+	}
+	return ""
+}
+
+// ancestors 祖先をルートから順に返す
+func (t *Server) ancestors(c *content) []*content {
+	var ret []*content
+	for id := c.parentID; id != ""; {
+		p, ok := t.contents[id]
+		if !ok {
+			break
+		}
+		ret = append([]*content{p}, ret...)
+		id = p.parentID
+	}
+	return ret
+}
+
+func (t *Server) findByTitle(spaceKey, typ, title string) *content {
+	for _, id := range t.order {
+		c := t.contents[id]
+		if c.spaceKey == spaceKey && c.typ == typ && c.current().title == title {
+			return c
+		}
+	}
+	return nil
+}
+
+func (t *content) current() revision {
+	return t.versions[len(t.versions)-1]
+}
+
+func (t *content) addLabel(label string) {
+	for _, v := range t.labels {
+		if v == label {
+			return
+		}
+	}
+	t.labels = append(t.labels, label)
+}
+
+func (t *content) removeLabel(label string) bool {
+	for i, v := range t.labels {
+		if v == label {
+			t.labels = append(t.labels[:i], t.labels[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Server) toContent(c *content, rev revision) confluence.Content {
+	ret := confluence.Content{
+		ID:     c.id,
+		Type:   c.typ,
+		Status: "current",
+		Title:  rev.title,
+		Space:  confluence.ContentSpace{Key: c.spaceKey},
+		Version: confluence.Version{
+			By:      confluence.User{Type: "known", Username: t.username},
+			When:    rev.when.Format(time.RFC3339),
+			Message: rev.message,
+			Number:  rev.number,
+		},
+		Body: confluence.ContentBody{
+			Storage: confluence.ContentStorage{Value: rev.body, Representation: "storage"},
+		},
+		Links: map[string]string{
+			"self":  t.URL + "/rest/api/content/" + c.id,
+			"webui": "/pages/viewpage.action?pageId=" + c.id,
+		},
+	}
+	if rev.number != c.current().number {
+		ret.Status = "historical"
+	}
+	for _, a := range t.ancestors(c) {
+		ret.Ancestors = append(ret.Ancestors, confluence.Content{
+			ID:    a.id,
+			Type:  a.typ,
+			Title: a.current().title,
+		})
+	}
+	return ret
+}
+
+func (t *Server) toAttachment(c *content) confluence.AttachmentFetchResult {
+	rev := c.current()
+	var labels []interface{}
+	for _, l := range c.labels {
+		labels = append(labels, map[string]interface{}{"prefix": "global", "name": l, "id": l})
+	}
+	return confluence.AttachmentFetchResult{
+		ID:     c.id,
+		Type:   "attachment",
+		Status: "current",
+		Title:  rev.title,
+		MetaData: confluence.AttachmentMetaData{
+			MediaType: c.mediaType,
+			Labels: confluence.AttachmentLabels{
+				Results: labels,
+				Size:    float64(len(labels)),
+			},
+		},
+		Extensions: confluence.AttachmentExtensions{
+			MediaType: c.mediaType,
+			FileSize:  float64(len(c.data)),
+			Comment:   c.comment,
+		},
+		Version: confluence.Version{
+			When:   rev.when.Format(time.RFC3339),
+			Number: rev.number,
+		},
+		Links: confluence.AttachmentLinks{
+			Self:     t.URL + "/rest/api/content/" + c.id,
+			Download: "/download/attachments/" + c.containerID + "/" + url.PathEscape(rev.title) + "?version=" + strconv.Itoa(rev.number),
+		},
+	}
+}
+
+// pageOf allをstart, limitで切り出したレスポンスを返す
+func pageOf(r *http.Request, all []interface{}) map[string]interface{} {
+	if all == nil {
+		all = []interface{}{}
+	}
+	q := r.URL.Query()
+	start, _ := strconv.Atoi(q.Get("start"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if start < 0 || len(all) < start {
+		start = len(all)
+	}
+	end := start + limit
+	if len(all) < end {
+		end = len(all)
+	}
+
+	links := map[string]string{}
+	if end < len(all) {
+		q.Set("start", strconv.Itoa(end))
+		q.Set("limit", strconv.Itoa(limit))
+		links["next"] = r.URL.Path + "?" + q.Encode()
+	}
+	return map[string]interface{}{
+		"results":   all[start:end],
+		"start":     start,
+		"limit":     limit,
+		"size":      end - start,
+		"totalSize": len(all),
+		"_links":    links,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"statusCode": status,
+		"message":    message,
+	})
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
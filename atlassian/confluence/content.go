@@ -0,0 +1,68 @@
+package confluence
+
+// Content コンテンツ
+type Content struct {
+	ID        string            `json:"id"`
+	Type      string            `json:"type"`
+	Status    string            `json:"status"`
+	Title     string            `json:"title"`
+	Space     ContentSpace      `json:"space"`
+	Version   Version           `json:"version"`
+	Body      ContentBody       `json:"body"`
+	Ancestors []Content         `json:"ancestors"`
+	Links     map[string]string `json:"_links"`
+}
+
+// ContentResults Results
+type ContentResults struct {
+	Results []Content         `json:"results"`
+	Start   int               `json:"start"`
+	Limit   int               `json:"limit"`
+	Size    int               `json:"size"`
+	Links   map[string]string `json:"_links"`
+}
+
+// ContentSpace スペース
+type ContentSpace struct {
+	ID   float64 `json:"id"`
+	Key  string  `json:"key"`
+	Name string  `json:"name"`
+}
+
+// ContentBody body
+type ContentBody struct {
+	Storage ContentStorage `json:"storage"`
+}
+
+// ContentStorage storage形式の本文
+type ContentStorage struct {
+	Value          string `json:"value"`
+	Representation string `json:"representation"`
+}
+
+// User ユーザー
+type User struct {
+	Type        string `json:"type"`
+	Username    string `json:"username"`
+	UserKey     string `json:"userKey"`
+	AccountID   string `json:"accountId"`
+	DisplayName string `json:"displayName"`
+}
+
+// Version バージョン情報
+type Version struct {
+	By        User   `json:"by"`
+	When      string `json:"when"`
+	Message   string `json:"message"`
+	Number    int    `json:"number"`
+	MinorEdit bool   `json:"minorEdit"`
+}
+
+// VersionResults Results
+type VersionResults struct {
+	Results []Version         `json:"results"`
+	Start   int               `json:"start"`
+	Limit   int               `json:"limit"`
+	Size    int               `json:"size"`
+	Links   map[string]string `json:"_links"`
+}
@@ -0,0 +1,227 @@
+package confluence
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/naminomare/gogutil/fileio"
+)
+
+var (
+	// DefaultDownloadConcurrency 同時ダウンロード数のデフォルト
+	DefaultDownloadConcurrency = 4
+
+	// PartialFileExt ダウンロード途中のファイルの拡張子
+	PartialFileExt = ".part"
+
+	// ErrSizeMismatch ダウンロードしたサイズがメタデータと一致しない時
+	ErrSizeMismatch = errors.New("ダウンロードしたファイルのサイズが一致しません")
+
+	// ErrInvalidFileName 添付ファイル名がそのまま保存できない時。ディレクトリの区切りや".."を含むなど
+	ErrInvalidFileName = errors.New("添付ファイル名が不正です")
+)
+
+// DownloadOptions 添付ファイルダウンロードの設定
+type DownloadOptions struct {
+	// Concurrency 同時ダウンロード数。0の場合はDefaultDownloadConcurrency
+	Concurrency int
+	// Resume 途中まで落ちているファイルがあればRangeで続きから落とす
+	Resume bool
+	// SkipExisting 同名・同サイズのファイルが既にあればダウンロードしない
+	SkipExisting bool
+	// Filter 一致する添付ファイルだけダウンロードする
+	Filter AttachmentFilter
+}
+
+// DownloadResult ファイルごとのダウンロード結果
+type DownloadResult struct {
+	Attachment AttachmentFetchResult
+	// Path 保存先。失敗した時は空
+	Path string
+	// Size 保存したファイルのサイズ
+	Size    int64
+	Skipped bool
+	Resumed bool
+	Err     error
+}
+
+// DownloadAttachmentsWithOptions ページに添付してあるファイルを並列にダウンロードする
+// ファイルごとの結果を返す。メタデータの取得に失敗した場合のみerrを返す
+func (t *Client) DownloadAttachmentsWithOptions(
+	pageID,
+	directory string,
+	opts DownloadOptions,
+) ([]DownloadResult, error) {
+	attachments, err := t.FetchAllAttachments(pageID)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(directory, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	return t.DownloadAttachments(FilterAttachments(attachments, opts.Filter), directory, opts), nil
+}
+
+// DownloadAttachments attachmentsをdirectoryに並列にダウンロードする
+// HTTPWaitClientを複数のgoroutineで共有するので、リクエストはHTTPWaitClientの間隔で順番に始まる
+func (t *Client) DownloadAttachments(
+	attachments []AttachmentFetchResult,
+	directory string,
+	opts DownloadOptions,
+) []DownloadResult {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultDownloadConcurrency
+	}
+
+	results := make([]DownloadResult, len(attachments))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				results[idx] = t.downloadAttachment(attachments[idx], directory, opts)
+			}
+		}()
+	}
+	for i := range attachments {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+func (t *Client) downloadAttachment(
+	attachment AttachmentFetchResult,
+	directory string,
+	opts DownloadOptions,
+) DownloadResult {
+	ret := DownloadResult{Attachment: attachment}
+	expectedSize := int64(attachment.Extensions.FileSize)
+	name, err := attachmentFileName(attachment.Title)
+	if err != nil {
+		ret.Err = err
+		return ret
+	}
+	path := filepath.Join(directory, name)
+
+	if opts.SkipExisting && expectedSize > 0 {
+		if info, err := os.Stat(path); err == nil && info.Size() == expectedSize {
+			ret.Path = path
+			ret.Size = expectedSize
+			ret.Skipped = true
+			return ret
+		}
+	}
+
+	partPath := path + PartialFileExt
+	size, resumed, err := t.downloadToPartialFile(t.rest.URL(attachment.Links.Download, nil), partPath, opts.Resume)
+	ret.Resumed = resumed
+	if err != nil {
+		ret.Err = err
+		return ret
+	}
+	if expectedSize > 0 && size != expectedSize {
+		os.Remove(partPath)
+		ret.Err = ErrSizeMismatch
+		return ret
+	}
+
+	dst, err := fileio.GetNonExistFileName(path, 1000)
+	if err != nil {
+		ret.Err = err
+		return ret
+	}
+	err = os.Rename(partPath, dst)
+	if err != nil {
+		ret.Err = err
+		return ret
+	}
+	ret.Path = dst
+	ret.Size = size
+	return ret
+}
+
+// attachmentFileName 保存するファイル名
+// タイトルはサーバーから来るので、directoryの外に書かないようにディレクトリを含むものは断る
+func attachmentFileName(title string) (string, error) {
+	if strings.ContainsAny(title, `/\`) || strings.ContainsRune(title, 0) {
+		return "", ErrInvalidFileName
+	}
+	name := filepath.Base(title)
+	if name != title || name == "." || name == ".." {
+		return "", ErrInvalidFileName
+	}
+	return name, nil
+}
+
+// downloadToPartialFile partPathにダウンロードする
+// resumeがtrueでpartPathが既にある場合は続きから落とす
+// 失敗した時、resumeがfalseならpartPathを消す
+func (t *Client) downloadToPartialFile(url, partPath string, resume bool) (int64, bool, error) {
+	var offset int64
+	if resume {
+		if info, err := os.Stat(partPath); err == nil {
+			offset = info.Size()
+		}
+	}
+
+	var header map[string]string
+	if offset > 0 {
+		header = map[string]string{
+			"Range": "bytes=" + strconv.FormatInt(offset, 10) + "-",
+		}
+	}
+	resp, err := t.rest.HTTPClient().DoRequest(
+		http.MethodGet,
+		url,
+		nil,
+		header,
+	)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	resumed := false
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		resumed = true
+	case offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// 既に最後まで落ちている
+		return offset, true, nil
+	case resp.StatusCode != http.StatusOK:
+		return 0, false, decodeResponse(resp, nil)
+	default:
+		offset = 0
+	}
+
+	fh, err := os.OpenFile(partPath, flag, 0644)
+	if err != nil {
+		return 0, false, err
+	}
+	n, err := t.rest.HTTPClient().WriteDownload(fh, resp, filepath.Dir(partPath))
+	cerr := fh.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err != nil {
+		if !resume {
+			os.Remove(partPath)
+		}
+		return 0, resumed, err
+	}
+	return offset + n, resumed, nil
+}
@@ -0,0 +1,276 @@
+package confluence
+
+import (
+	"errors"
+	"html"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// JiraChartType Jiraチャートマクロの種類
+type JiraChartType string
+
+var (
+	// JiraChartPie 円グラフ
+	JiraChartPie JiraChartType = "pie"
+
+	// JiraChartCreatedVsResolved 作成済みと解決済みの比較
+	JiraChartCreatedVsResolved JiraChartType = "createdvsresolved"
+
+	// JiraChartTwoDimensional 2次元の集計表
+	JiraChartTwoDimensional JiraChartType = "twodimensional"
+
+	// ApplicationTypeJira Jiraのアプリケーションリンクのタイプ
+	ApplicationTypeJira = "jira"
+
+	// ErrApplicationLinkNotFound アプリケーションリンクが見つからない時
+	ErrApplicationLinkNotFound = errors.New("アプリケーションリンクが見つかりません")
+
+	// jiraMacroRegexp jira, jirachartマクロ
+	jiraMacroRegexp = regexp.MustCompile(`(?s)<ac:structured-macro\s+ac:name="(?:jira|jirachart)".*?</ac:structured-macro>`)
+	// jiraServerParamRegexp マクロのserver, serverIdパラメータ
+	jiraServerParamRegexp = regexp.MustCompile(`<ac:parameter\s+ac:name="(server|serverId)">([^<]*)</ac:parameter>`)
+)
+
+// ApplicationLink アプリケーションリンク
+type ApplicationLink struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	TypeID     string `json:"typeId"`
+	DisplayURL string `json:"displayUrl"`
+	RPCURL     string `json:"rpcUrl"`
+	IsPrimary  bool   `json:"isPrimary"`
+}
+
+// ApplicationLinkResults Results
+type ApplicationLinkResults struct {
+	ApplicationLinks []ApplicationLink `json:"applicationLinks"`
+}
+
+// JiraServer Jiraマクロで参照するサーバー
+// Nameはアプリケーションリンクの名前、IDはアプリケーションリンクのID
+type JiraServer struct {
+	Name string
+	ID   string
+}
+
+// JiraServer アプリケーションリンクをJiraServerにする
+func (t ApplicationLink) JiraServer() JiraServer {
+	return JiraServer{
+		Name: t.Name,
+		ID:   t.ID,
+	}
+}
+
+// JiraIssuesOptions JiraIssuesMacroのオプション
+type JiraIssuesOptions struct {
+	// Columns 表示する列。空の場合はサーバーのデフォルト
+	Columns []string
+	// MaximumIssues 表示する最大件数。0の場合はサーバーのデフォルト
+	MaximumIssues int
+	// Count trueの場合は表ではなく件数だけ表示する
+	Count bool
+}
+
+// JiraChartOptions JiraChartMacroのオプション
+type JiraChartOptions struct {
+	// ChartType 空の場合はJiraChartPie
+	ChartType JiraChartType
+	// StatType 集計する項目。"statuses", "assignees"など。円グラフの時に使う
+	StatType string
+	// Width "300px"や"50%"など。空の場合はサーバーのデフォルト
+	Width string
+	// Border 枠線を表示する
+	Border bool
+	// ShowInfo 集計の情報を表示する
+	ShowInfo bool
+}
+
+// FetchApplicationLinks アプリケーションリンクの一覧を取得する
+func (t *Client) FetchApplicationLinks() ([]ApplicationLink, error) {
+	var res ApplicationLinkResults
+	err := t.rest.DoDecode(http.MethodGet, "/rest/applinks/1.0/applicationlink", nil, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.ApplicationLinks, nil
+}
+
+// FindJiraServer 名前かIDでJiraのアプリケーションリンクを探す
+// nameが空の場合はプライマリのリンク。見つからない場合はErrApplicationLinkNotFound
+func (t *Client) FindJiraServer(name string) (JiraServer, error) {
+	links, err := t.FetchApplicationLinks()
+	if err != nil {
+		return JiraServer{}, err
+	}
+	if name == "" {
+		link, ok := findJiraLink(links, JiraServer{})
+		if !ok {
+			return JiraServer{}, ErrApplicationLinkNotFound
+		}
+		return link.JiraServer(), nil
+	}
+	for _, v := range links {
+		if v.TypeID == ApplicationTypeJira && (v.Name == name || v.ID == name) {
+			return v.JiraServer(), nil
+		}
+	}
+	return JiraServer{}, ErrApplicationLinkNotFound
+}
+
+// ValidateJiraServer serverのアプリケーションリンクがあるか確認する
+// IDが空の場合は名前で確認する。見つからない場合はErrApplicationLinkNotFound
+func (t *Client) ValidateJiraServer(server JiraServer) error {
+	links, err := t.FetchApplicationLinks()
+	if err != nil {
+		return err
+	}
+	if _, ok := findJiraLink(links, server); !ok {
+		return ErrApplicationLinkNotFound
+	}
+	return nil
+}
+
+// ValidateJiraMacros storage内のJiraマクロが参照しているアプリケーションリンクがあるか確認する
+// CreateContent, UpdateContentの前に呼ぶと、リンク切れのマクロを含むページを作らずに済む
+func (t *Client) ValidateJiraMacros(storage string) error {
+	servers := jiraServersInStorage(storage)
+	if len(servers) == 0 {
+		return nil
+	}
+	links, err := t.FetchApplicationLinks()
+	if err != nil {
+		return err
+	}
+	for _, v := range servers {
+		if _, ok := findJiraLink(links, v); !ok {
+			return ErrApplicationLinkNotFound
+		}
+	}
+	return nil
+}
+
+// JiraIssuesMacro jqlの課題一覧を表示するマクロを返す
+func JiraIssuesMacro(server JiraServer, jql string, opts JiraIssuesOptions) string {
+	params := jiraServerParams(server)
+	params = append(params, [2]string{"jqlQuery", jql})
+	if len(opts.Columns) > 0 {
+		params = append(params, [2]string{"columns", strings.Join(opts.Columns, ",")})
+	}
+	if opts.MaximumIssues > 0 {
+		params = append(params, [2]string{"maximumIssues", strconv.Itoa(opts.MaximumIssues)})
+	}
+	if opts.Count {
+		params = append(params, [2]string{"count", "true"})
+	}
+	return structuredMacro("jira", params)
+}
+
+// JiraIssueMacro 課題をひとつ表示するマクロを返す
+func JiraIssueMacro(server JiraServer, issueKey string) string {
+	params := jiraServerParams(server)
+	params = append(params, [2]string{"key", issueKey})
+	return structuredMacro("jira", params)
+}
+
+// JiraChartMacro jqlの課題を集計したチャートのマクロを返す
+func JiraChartMacro(server JiraServer, jql string, opts JiraChartOptions) string {
+	chartType := opts.ChartType
+	if chartType == "" {
+		chartType = JiraChartPie
+	}
+	params := jiraServerParams(server)
+	params = append(params,
+		[2]string{"jql", jql},
+		[2]string{"chartType", string(chartType)},
+		[2]string{"isAuthenticated", "true"},
+	)
+	if opts.StatType != "" {
+		params = append(params, [2]string{"statType", opts.StatType})
+	}
+	if opts.Width != "" {
+		params = append(params, [2]string{"width", opts.Width})
+	}
+	params = append(params,
+		[2]string{"border", strconv.FormatBool(opts.Border)},
+		[2]string{"showinfor", strconv.FormatBool(opts.ShowInfo)},
+	)
+	return structuredMacro("jirachart", params)
+}
+
+func jiraServerParams(server JiraServer) [][2]string {
+	var ret [][2]string
+	if server.Name != "" {
+		ret = append(ret, [2]string{"server", server.Name})
+	}
+	if server.ID != "" {
+		ret = append(ret, [2]string{"serverId", server.ID})
+	}
+	return ret
+}
+
+// structuredMacro storage形式のマクロを返す。パラメータはエスケープする
+func structuredMacro(name string, params [][2]string) string {
+	b := &strings.Builder{}
+	b.WriteString(`<ac:structured-macro ac:name="` + html.EscapeString(name) + `" ac:schema-version="1">`)
+	for _, v := range params {
+		b.WriteString(`<ac:parameter ac:name="` + html.EscapeString(v[0]) + `">`)
+		b.WriteString(html.EscapeString(v[1]))
+		b.WriteString(`</ac:parameter>`)
+	}
+	b.WriteString(`</ac:structured-macro>`)
+	return b.String()
+}
+
+// jiraServersInStorage storage内のJiraマクロが参照しているサーバー
+func jiraServersInStorage(storage string) []JiraServer {
+	var ret []JiraServer
+	seen := map[JiraServer]bool{}
+	for _, macro := range jiraMacroRegexp.FindAllString(storage, -1) {
+		var server JiraServer
+		for _, m := range jiraServerParamRegexp.FindAllStringSubmatch(macro, -1) {
+			if m[1] == "server" {
+				server.Name = html.UnescapeString(m[2])
+			} else {
+				server.ID = html.UnescapeString(m[2])
+			}
+		}
+		if server == (JiraServer{}) || seen[server] {
+			continue
+		}
+		seen[server] = true
+		ret = append(ret, server)
+	}
+	return ret
+}
+
+// findJiraLink serverに一致するJiraのリンクを探す
+// IDが空の場合は名前で探す。両方空の場合はプライマリか最初のリンク
+func findJiraLink(links []ApplicationLink, server JiraServer) (ApplicationLink, bool) {
+	var found []ApplicationLink
+	for _, v := range links {
+		if v.TypeID != ApplicationTypeJira {
+			continue
+		}
+		switch {
+		case server.ID != "":
+			if v.ID == server.ID {
+				return v, true
+			}
+		case server.Name != "":
+			if v.Name == server.Name {
+				return v, true
+			}
+		case v.IsPrimary:
+			return v, true
+		default:
+			found = append(found, v)
+		}
+	}
+	if server.ID == "" && server.Name == "" && len(found) > 0 {
+		return found[0], true
+	}
+	return ApplicationLink{}, false
+}
@@ -0,0 +1,68 @@
+package confluence
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/naminomare/gogutil/atlassian/rest"
+)
+
+// Label ラベル
+type Label struct {
+	ID     string `json:"id"`
+	Prefix string `json:"prefix"`
+	Name   string `json:"name"`
+}
+
+// LabelResults Results
+type LabelResults struct {
+	Results []Label           `json:"results"`
+	Start   int               `json:"start"`
+	Limit   int               `json:"limit"`
+	Size    int               `json:"size"`
+	Links   map[string]string `json:"_links"`
+}
+
+// FetchLabels コンテンツのラベルを取得する
+func (t *Client) FetchLabels(contentID string) ([]Label, error) {
+	return rest.FetchAll(0, func(start, limit int) ([]Label, bool, error) {
+		var res LabelResults
+		err := t.rest.DoDecode(
+			http.MethodGet,
+			rest.Pathf("/rest/api/content/%s/label", contentID),
+			rest.SetPaging(nil, "start", start, "limit", limit),
+			nil,
+			&res,
+		)
+		if err != nil {
+			return nil, false, err
+		}
+		return res.Results, res.Links["next"] != "", nil
+	})
+}
+
+// AddLabels コンテンツにラベルを付ける
+func (t *Client) AddLabels(contentID string, labels []string) error {
+	body := make([]Label, 0, len(labels))
+	for _, v := range labels {
+		body = append(body, Label{Prefix: "global", Name: v})
+	}
+	return t.rest.DoDecode(
+		http.MethodPost,
+		rest.Pathf("/rest/api/content/%s/label", contentID),
+		nil,
+		body,
+		nil,
+	)
+}
+
+// RemoveLabel コンテンツからラベルを外す
+func (t *Client) RemoveLabel(contentID, label string) error {
+	return t.rest.DoDecode(
+		http.MethodDelete,
+		rest.Pathf("/rest/api/content/%s/label", contentID),
+		url.Values{"name": {label}},
+		nil,
+		nil,
+	)
+}
@@ -0,0 +1,402 @@
+package confluence
+
+import (
+	"html"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/naminomare/gogutil/fileio"
+)
+
+// ReportFileKind レポートでのファイルの表示のしかた
+type ReportFileKind string
+
+var (
+	// ReportFileImage ページに画像として表示する
+	ReportFileImage ReportFileKind = "image"
+
+	// ReportFileLog expandマクロの中にテキストで表示する
+	ReportFileLog ReportFileKind = "log"
+
+	// ReportFileAttachment 添付ファイルへのリンクにする
+	ReportFileAttachment ReportFileKind = "attachment"
+
+	// DefaultReportImageExts ReportOptions.ImageExtsが空の時に使う
+	DefaultReportImageExts = []string{".png", ".jpg", ".jpeg", ".gif", ".svg"}
+
+	// DefaultReportLogExts ReportOptions.LogExtsが空の時に使う
+	DefaultReportLogExts = []string{".log", ".txt"}
+
+	// DefaultReportMaxLogSize ReportOptions.MaxLogSizeが0の時に使う
+	DefaultReportMaxLogSize int64 = 64 << 10
+
+	// DefaultReportUploadBatchSize ReportOptions.UploadBatchSizeが0の時に使う
+	DefaultReportUploadBatchSize = 20
+)
+
+// ReportOptions PublishReportのオプション
+type ReportOptions struct {
+	// SpaceKey ページを作るスペース
+	SpaceKey string
+	// ParentID 新しく作る時の親ページ。既にある場合は移動しない
+	ParentID string
+	// BaseDirectory ファイル名をこのディレクトリからの相対パスで表示する
+	// 空の場合はPublishReportDirectoryのディレクトリ、それ以外は表示も添付もファイル名だけ
+	BaseDirectory string
+	// Description 表の前に入れるstorage形式の内容
+	Description string
+	// ImageExts 画像として表示する拡張子
+	ImageExts []string
+	// LogExts expandマクロで表示する拡張子
+	LogExts []string
+	// MaxLogSize ページに埋め込むログの最大バイト数。超えた場合は末尾だけ埋め込む
+	MaxLogSize int64
+	// UploadBatchSize 新しい添付ファイルを1回のリクエストで送る数。0の場合はDefaultReportUploadBatchSize
+	UploadBatchSize int
+}
+
+// ReportFile レポートに載せたファイル
+type ReportFile struct {
+	// Path ローカルのパス
+	Path string `json:"path"`
+	// Name 添付ファイル名
+	Name string         `json:"name"`
+	Kind ReportFileKind `json:"kind"`
+	Size int64          `json:"size"`
+	// Replaced 既にあった添付ファイルを新しいバージョンにした
+	Replaced bool `json:"replaced"`
+}
+
+// ReportResult PublishReportの結果
+type ReportResult struct {
+	Page Content `json:"page"`
+	// Created ページを新しく作った
+	Created bool         `json:"created"`
+	Files   []ReportFile `json:"files"`
+}
+
+// PublishReportDirectory directory以下のファイルをすべてレポートにする
+// directoryがディレクトリでない場合はErrInvalidArgumentsを返す
+func (t *Client) PublishReportDirectory(directory, title string, opts ReportOptions) (*ReportResult, error) {
+	files, err := directoryFiles(directory)
+	if err != nil {
+		return nil, err
+	}
+	if opts.BaseDirectory == "" {
+		opts.BaseDirectory = directory
+	}
+	return t.PublishReport(title, files, opts)
+}
+
+// directoryFiles directory以下のファイルをすべて返す。読めないディレクトリがあればエラーにする
+func directoryFiles(directory string) ([]string, error) {
+	info, err := os.Stat(directory)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, ErrInvalidArguments
+	}
+	var ret []string
+	err = filepath.WalkDir(directory, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			ret = append(ret, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// PublishReport filesをまとめたページを作る。既に同じタイトルのページがある場合は更新する
+// 画像はページに表示し、ログはexpandマクロに入れ、それ以外は添付ファイルへのリンクにする
+// ファイルはすべて添付し、同じ名前の添付ファイルがある場合は新しいバージョンにする
+func (t *Client) PublishReport(title string, files []string, opts ReportOptions) (*ReportResult, error) {
+	if opts.SpaceKey == "" || title == "" {
+		return nil, ErrInvalidArguments
+	}
+	reportFiles, err := opts.reportFiles(files)
+	if err != nil {
+		return nil, err
+	}
+	body, err := opts.renderReport(reportFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &ReportResult{}
+	page, err := t.findPageByTitle(opts.SpaceKey, title)
+	switch {
+	case err == ErrNotFound:
+		resp, err := t.CreateContent(opts.SpaceKey, opts.ParentID, title, body, PageTypePage)
+		if err != nil {
+			return nil, err
+		}
+		err = decodeResponse(resp, &ret.Page)
+		if err != nil {
+			return nil, err
+		}
+		ret.Created = true
+	case err != nil:
+		return nil, err
+	default:
+		resp, err := t.UpdateContent(page.ID, float64(page.Version.Number), page.Type, title, body)
+		if err != nil {
+			return nil, err
+		}
+		err = decodeResponse(resp, &ret.Page)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = t.uploadReportFiles(ret.Page.ID, reportFiles, opts.uploadBatchSize())
+	ret.Files = reportFiles
+	if err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+func (t *Client) findPageByTitle(spaceKey, title string) (*Content, error) {
+	resp, err := t.FetchContentByTitle(spaceKey, title)
+	if err != nil {
+		return nil, err
+	}
+	var res ContentResults
+	err = decodeResponse(resp, &res)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range res.Results {
+		if v.Type == string(PageTypePage) {
+			return &v, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// uploadReportFiles 既にある添付ファイルは新しいバージョンにして、それ以外はbatchSize個ずつ添付する
+// ファイルは送る間だけ開く
+func (t *Client) uploadReportFiles(pageID string, files []ReportFile, batchSize int) error {
+	existing, err := t.FetchAllAttachments(pageID)
+	if err != nil {
+		return err
+	}
+	ids := map[string]string{}
+	for _, v := range existing {
+		ids[v.Title] = v.ID
+	}
+
+	var paths []string
+	var names []string
+	for i, f := range files {
+		id, ok := ids[f.Name]
+		if !ok {
+			paths = append(paths, f.Path)
+			names = append(names, f.Name)
+			continue
+		}
+		err = t.replaceReportFile(pageID, id, f)
+		if err != nil {
+			return err
+		}
+		files[i].Replaced = true
+	}
+	for len(paths) > 0 {
+		n := batchSize
+		if n > len(paths) {
+			n = len(paths)
+		}
+		resp, err := t.addAttachmentFiles(pageID, paths[:n], names[:n])
+		if err != nil {
+			return err
+		}
+		err = decodeResponse(resp, nil)
+		if err != nil {
+			return err
+		}
+		paths, names = paths[n:], names[n:]
+	}
+	return nil
+}
+
+// replaceReportFile 既にある添付ファイルidをfの内容で新しいバージョンにする
+func (t *Client) replaceReportFile(pageID, id string, f ReportFile) error {
+	fh, err := os.Open(f.Path)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	resp, err := t.UpdateAttachmentData(pageID, id, f.Name, fh)
+	if err != nil {
+		return err
+	}
+	return decodeResponse(resp, nil)
+}
+
+// reportFiles ディレクトリを除いて、添付ファイル名と種類を決める
+func (t ReportOptions) reportFiles(files []string) ([]ReportFile, error) {
+	var ret []ReportFile
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		ret = append(ret, ReportFile{
+			Path: path,
+			Name: t.attachmentName(path),
+			Kind: t.kindOf(path),
+			Size: info.Size(),
+		})
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	for i := 1; i < len(ret); i++ {
+		if ret[i].Name == ret[i-1].Name {
+			// 添付ファイル名が重なると片方が消えるので断る
+			return nil, ErrInvalidArguments
+		}
+	}
+	return ret, nil
+}
+
+// attachmentName 添付ファイル名。サブディレクトリは"_"でつなぐ
+func (t ReportOptions) attachmentName(path string) string {
+	if t.BaseDirectory == "" {
+		return fileio.FileName(path)
+	}
+	rel, err := filepath.Rel(t.BaseDirectory, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return fileio.FileName(path)
+	}
+	return strings.ReplaceAll(filepath.ToSlash(rel), "/", "_")
+}
+
+func (t ReportOptions) kindOf(path string) ReportFileKind {
+	ext := strings.ToLower(filepath.Ext(path))
+	imageExts := t.ImageExts
+	if len(imageExts) == 0 {
+		imageExts = DefaultReportImageExts
+	}
+	logExts := t.LogExts
+	if len(logExts) == 0 {
+		logExts = DefaultReportLogExts
+	}
+	for _, v := range imageExts {
+		if strings.EqualFold(v, ext) {
+			return ReportFileImage
+		}
+	}
+	for _, v := range logExts {
+		if strings.EqualFold(v, ext) {
+			return ReportFileLog
+		}
+	}
+	return ReportFileAttachment
+}
+
+// renderReport 索引の表のstorage
+func (t ReportOptions) renderReport(files []ReportFile) (string, error) {
+	b := &strings.Builder{}
+	b.WriteString(t.Description)
+	b.WriteString("<table><tbody>")
+	b.WriteString("<tr><th>ファイル</th><th>サイズ</th><th>内容</th></tr>")
+	for _, f := range files {
+		b.WriteString("<tr><td>" + html.EscapeString(f.Name) + "</td>")
+		b.WriteString("<td>" + strconv.FormatInt(f.Size, 10) + "</td><td>")
+		switch f.Kind {
+		case ReportFileImage:
+			b.WriteString(`<ac:image><ri:attachment ri:filename="` + html.EscapeString(f.Name) + `" /></ac:image>`)
+		case ReportFileLog:
+			text, truncated, err := t.readLog(f)
+			if err != nil {
+				return "", err
+			}
+			title := f.Name
+			if truncated {
+				title += " (末尾 " + strconv.FormatInt(t.maxLogSize(), 10) + " バイト)"
+			}
+			b.WriteString(`<ac:structured-macro ac:name="expand" ac:schema-version="1">`)
+			b.WriteString(`<ac:parameter ac:name="title">` + html.EscapeString(title) + `</ac:parameter>`)
+			b.WriteString(`<ac:rich-text-body><ac:structured-macro ac:name="code" ac:schema-version="1">`)
+			b.WriteString(`<ac:plain-text-body>` + cdata(text) + `</ac:plain-text-body>`)
+			b.WriteString(`</ac:structured-macro></ac:rich-text-body></ac:structured-macro>`)
+			b.WriteString(attachmentLink(f.Name))
+		default:
+			b.WriteString(attachmentLink(f.Name))
+		}
+		b.WriteString("</td></tr>")
+	}
+	b.WriteString("</tbody></table>")
+	return b.String(), nil
+}
+
+func (t ReportOptions) uploadBatchSize() int {
+	if t.UploadBatchSize <= 0 {
+		return DefaultReportUploadBatchSize
+	}
+	return t.UploadBatchSize
+}
+
+func (t ReportOptions) maxLogSize() int64 {
+	if t.MaxLogSize <= 0 {
+		return DefaultReportMaxLogSize
+	}
+	return t.MaxLogSize
+}
+
+// readLog ログの末尾maxLogSizeバイトを読む
+func (t ReportOptions) readLog(f ReportFile) (string, bool, error) {
+	fh, err := os.Open(f.Path)
+	if err != nil {
+		return "", false, err
+	}
+	defer fh.Close()
+
+	truncated := f.Size > t.maxLogSize()
+	if truncated {
+		_, err = fh.Seek(f.Size-t.maxLogSize(), io.SeekStart)
+		if err != nil {
+			return "", false, err
+		}
+	}
+	bin, err := io.ReadAll(io.LimitReader(fh, t.maxLogSize()))
+	if err != nil {
+		return "", false, err
+	}
+	return strings.Map(xmlChar, strings.ToValidUTF8(string(bin), "")), truncated, nil
+}
+
+func attachmentLink(name string) string {
+	return `<p><ac:link><ri:attachment ri:filename="` + html.EscapeString(name) + `" />` +
+		`<ac:plain-text-link-body>` + cdata(name) + `</ac:plain-text-link-body></ac:link></p>`
+}
+
+// cdata CDATAセクションにする。中の"]]>"は分割する
+func cdata(text string) string {
+	return "<![CDATA[" + strings.ReplaceAll(text, "]]>", "]]]]><![CDATA[>") + "]]>"
+}
+
+// xmlChar XMLで使えない制御文字を消す。ログのエスケープシーケンスなど
+func xmlChar(r rune) rune {
+	if r == '\t' || r == '\n' || r == '\r' || r >= 0x20 {
+		return r
+	}
+	return -1
+}
@@ -0,0 +1,210 @@
+package confluence
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/naminomare/gogutil/atlassian/rest"
+)
+
+// RestrictionOperation 制限する操作
+type RestrictionOperation string
+
+var (
+	// RestrictionRead 閲覧
+	RestrictionRead RestrictionOperation = "read"
+
+	// RestrictionUpdate 編集
+	RestrictionUpdate RestrictionOperation = "update"
+)
+
+// Restriction 操作ごとの制限
+// Users, Groupsのどちらも空の場合は制限なし
+type Restriction struct {
+	Operation RestrictionOperation
+	Users     []User
+	Groups    []string
+}
+
+type restrictionUserResults struct {
+	Results []User `json:"results"`
+}
+
+type restrictionGroup struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type restrictionGroupResults struct {
+	Results []restrictionGroup `json:"results"`
+}
+
+type restrictionByOperation struct {
+	Operation    string `json:"operation"`
+	Restrictions struct {
+		User  restrictionUserResults  `json:"user"`
+		Group restrictionGroupResults `json:"group"`
+	} `json:"restrictions"`
+}
+
+// FetchRestrictions コンテンツの閲覧・編集制限を取得する
+func (t *Client) FetchRestrictions(contentID string) ([]Restriction, error) {
+	var res map[string]restrictionByOperation
+	err := t.rest.DoDecode(
+		http.MethodGet,
+		rest.Pathf("/rest/api/content/%s/restriction/byOperation", contentID),
+		url.Values{"expand": {"restrictions.user,restrictions.group"}},
+		nil,
+		&res,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []Restriction
+	for _, op := range []RestrictionOperation{RestrictionRead, RestrictionUpdate} {
+		v, ok := res[string(op)]
+		if !ok {
+			continue
+		}
+		r := Restriction{
+			Operation: op,
+			Users:     v.Restrictions.User.Results,
+		}
+		for _, g := range v.Restrictions.Group.Results {
+			r.Groups = append(r.Groups, g.Name)
+		}
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
+
+// SetRestrictions コンテンツの閲覧・編集制限を置き換える
+// restrictionsに含まれない操作の制限は外される
+func (t *Client) SetRestrictions(contentID string, restrictions []Restriction) (*http.Response, error) {
+	body := []interface{}{}
+	for _, r := range restrictions {
+		users := []map[string]string{}
+		for _, u := range r.Users {
+			if u.AccountID != "" {
+				users = append(users, map[string]string{"type": "known", "accountId": u.AccountID})
+			} else {
+				users = append(users, map[string]string{"type": "known", "username": u.Username})
+			}
+		}
+		groups := []map[string]string{}
+		for _, g := range r.Groups {
+			groups = append(groups, map[string]string{"type": "group", "name": g})
+		}
+		body = append(body, map[string]interface{}{
+			"operation": r.Operation,
+			"restrictions": map[string]interface{}{
+				"user":  users,
+				"group": groups,
+			},
+		})
+	}
+	return t.rest.Do(http.MethodPut, rest.Pathf("/rest/experimental/content/%s/restriction", contentID), nil, body, nil)
+}
+
+// CopyRestrictions srcContentIDの制限をdstContentIDにコピーする
+func (t *Client) CopyRestrictions(srcContentID, dstContentID string) error {
+	restrictions, err := t.FetchRestrictions(srcContentID)
+	if err != nil {
+		return err
+	}
+	resp, err := t.SetRestrictions(dstContentID, restrictions)
+	if err != nil {
+		return err
+	}
+	return decodeResponse(resp, nil)
+}
+
+// CreateRestrictedContent templateContentIDと同じ制限をかけたコンテンツを作成する
+// templateContentIDに閲覧制限が無い場合はErrInvalidArgumentsを返す
+// 制限をかけるまで誰にも見えないように下書きで作成し、制限をかけてから公開する
+// 途中で失敗した場合は下書きを削除する。削除できなかった場合は作成したコンテンツもエラーと一緒に返すので、呼び出し元で消す
+func (t *Client) CreateRestrictedContent(
+	templateContentID,
+	spaceKey,
+	ancestorsID,
+	title,
+	content string,
+	pagetype PageType,
+) (*Content, error) {
+	restrictions, err := t.FetchRestrictions(templateContentID)
+	if err != nil {
+		return nil, err
+	}
+	if !hasReadRestriction(restrictions) {
+		// 閲覧制限の無いテンプレートから作ると、編集制限だけあってもスペースの全員に見えてしまう
+		return nil, ErrInvalidArguments
+	}
+
+	postMap := map[string]interface{}{
+		"type":   pagetype,
+		"status": "draft",
+		"title":  title,
+		"space": map[string]string{
+			"key": spaceKey,
+		},
+		"body": map[string]interface{}{
+			"storage": map[string]string{
+				"value":          content,
+				"representation": "storage",
+			},
+		},
+	}
+	if pagetype != PageTypeBlog && ancestorsID != "" {
+		postMap["ancestors"] = []interface{}{
+			map[string]string{
+				"id": ancestorsID,
+			},
+		}
+	}
+	var draft Content
+	err = t.rest.DoDecode(http.MethodPost, "/rest/api/content", url.Values{"status": {"draft"}}, postMap, &draft)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.SetRestrictions(draft.ID, restrictions)
+	if err == nil {
+		err = decodeResponse(resp, nil)
+	}
+	if err != nil {
+		return t.discardDraft(&draft, err)
+	}
+
+	// 下書きの公開はバージョン1への更新になる
+	postMap["status"] = "current"
+	postMap["version"] = map[string]int{
+		"number": 1,
+	}
+	var created Content
+	err = t.rest.DoDecode(http.MethodPut, rest.Pathf("/rest/api/content/%s", draft.ID), url.Values{"status": {"draft"}}, postMap, &created)
+	if err != nil {
+		return t.discardDraft(&draft, err)
+	}
+	return &created, nil
+}
+
+// discardDraft 下書きを削除してcauseを返す。削除できなかった場合は下書きも返す
+func (t *Client) discardDraft(draft *Content, cause error) (*Content, error) {
+	err := t.rest.DoDecode(http.MethodDelete, rest.Pathf("/rest/api/content/%s", draft.ID), url.Values{"status": {"draft"}}, nil, nil)
+	if err != nil {
+		return draft, fmt.Errorf("%w (下書き%sを削除できませんでした: %v)", cause, draft.ID, err)
+	}
+	return nil, cause
+}
+
+// hasReadRestriction 閲覧できるユーザーかグループが指定されているか
+func hasReadRestriction(restrictions []Restriction) bool {
+	for _, r := range restrictions {
+		if r.Operation == RestrictionRead && (len(r.Users) > 0 || len(r.Groups) > 0) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package confluence
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/naminomare/gogutil/atlassian/rest"
+)
+
+// cqlEscaper CQLの文字列の中でエスケープが必要な文字
+var cqlEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// QuoteCQL CQLの文字列リテラルにする。値をCQLに埋め込む時はこれを通す
+// 例: "space = " + QuoteCQL(spaceKey)
+func QuoteCQL(value string) string {
+	return `"` + cqlEscaper.Replace(value) + `"`
+}
+
+// SearchResult /rest/api/searchの結果
+type SearchResult struct {
+	Content      Content `json:"content"`
+	Title        string  `json:"title"`
+	Excerpt      string  `json:"excerpt"`
+	URL          string  `json:"url"`
+	LastModified string  `json:"lastModified"`
+	EntityType   string  `json:"entityType"`
+}
+
+// SearchResults Results
+type SearchResults struct {
+	Results   []SearchResult    `json:"results"`
+	Start     int               `json:"start"`
+	Limit     int               `json:"limit"`
+	Size      int               `json:"size"`
+	TotalSize int               `json:"totalSize"`
+	Links     map[string]string `json:"_links"`
+}
+
+// Search CQLで検索する。SearchPageByCQLの結果をデコードしたもの
+func (t *Client) Search(cql string, start, limit int) (*SearchResults, error) {
+	return t.SearchContext(context.Background(), cql, "", start, limit)
+}
+
+// SearchContext ctxを使ってCQLで検索する
+// expandは結果のcontentに含めるもの。例: "content.version"。空の場合は付けない
+func (t *Client) SearchContext(ctx context.Context, cql, expand string, start, limit int) (*SearchResults, error) {
+	query := url.Values{}
+	if cql != "" {
+		query.Set("cql", cql)
+	}
+	if expand != "" {
+		query.Set("expand", expand)
+	}
+	query = rest.SetPaging(query, "start", start, "limit", limit)
+	var res SearchResults
+	err := t.rest.DoDecodeContext(ctx, http.MethodGet, "/rest/api/search", query, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
@@ -0,0 +1,145 @@
+package confluence
+
+import (
+	"bytes"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"text/template"
+
+	"github.com/naminomare/gogutil/atlassian/rest"
+	"github.com/naminomare/gogutil/fileio"
+)
+
+// ContentTemplate コンテンツテンプレート
+type ContentTemplate struct {
+	TemplateID   string            `json:"templateId"`
+	Name         string            `json:"name"`
+	Description  string            `json:"description"`
+	TemplateType string            `json:"templateType"`
+	Space        ContentSpace      `json:"space"`
+	Body         ContentBody       `json:"body"`
+	Links        map[string]string `json:"_links"`
+}
+
+// ContentTemplateResults Results
+type ContentTemplateResults struct {
+	Results []ContentTemplate `json:"results"`
+	Start   int               `json:"start"`
+	Limit   int               `json:"limit"`
+	Size    int               `json:"size"`
+	Links   map[string]string `json:"_links"`
+}
+
+var (
+	// <at:var at:name="foo" /> のような変数
+	templateVarRegexp = regexp.MustCompile(`<at:var\s+at:name="([^"]*)"[^>]*?/>`)
+	// 変数の宣言部分
+	templateDeclarationsRegexp = regexp.MustCompile(`(?s)<at:declarations>.*?</at:declarations>`)
+
+	// LocalTemplateFuncs ローカルテンプレートで使える関数
+	LocalTemplateFuncs = template.FuncMap{
+		"escape": html.EscapeString,
+	}
+)
+
+// FetchTemplates スペースのページテンプレート一覧を取得する
+// spaceKeyが空の場合はグローバルテンプレート
+func (t *Client) FetchTemplates(spaceKey string, start, limit int) (*ContentTemplateResults, error) {
+	return t.fetchTemplates("/rest/experimental/template/page", spaceKey, start, limit)
+}
+
+// FetchBlueprints スペースのブループリント一覧を取得する
+func (t *Client) FetchBlueprints(spaceKey string, start, limit int) (*ContentTemplateResults, error) {
+	return t.fetchTemplates("/rest/experimental/template/blueprint", spaceKey, start, limit)
+}
+
+func (t *Client) fetchTemplates(path, spaceKey string, start, limit int) (*ContentTemplateResults, error) {
+	query := url.Values{"expand": {"body.storage"}}
+	if spaceKey != "" {
+		query.Set("spaceKey", spaceKey)
+	}
+	query = rest.SetPaging(query, "start", start, "limit", limit)
+	var res ContentTemplateResults
+	err := t.rest.DoDecode(http.MethodGet, path, query, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// FetchTemplate テンプレートをstorage本文付きで取得する
+func (t *Client) FetchTemplate(templateID string) (*ContentTemplate, error) {
+	var res ContentTemplate
+	err := t.rest.DoDecode(
+		http.MethodGet,
+		rest.Pathf("/rest/experimental/template/%s", templateID),
+		url.Values{"expand": {"body.storage"}},
+		nil,
+		&res,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ApplyTemplateVariables テンプレートの<at:var>をvariablesの値で置き換える
+// variablesに無い変数は空文字になる。値はエスケープされる
+func ApplyTemplateVariables(storage string, variables map[string]string) string {
+	storage = templateDeclarationsRegexp.ReplaceAllString(storage, "")
+	return templateVarRegexp.ReplaceAllStringFunc(storage, func(s string) string {
+		name := templateVarRegexp.FindStringSubmatch(s)[1]
+		return html.EscapeString(variables[name])
+	})
+}
+
+// CreateContentFromTemplate テンプレートに変数を埋め込んでコンテンツを作成する
+func (t *Client) CreateContentFromTemplate(
+	templateID,
+	spaceKey,
+	ancestorsID,
+	title string,
+	variables map[string]string,
+	pagetype PageType,
+) (*http.Response, error) {
+	tmpl, err := t.FetchTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+	content := ApplyTemplateVariables(tmpl.Body.Storage.Value, variables)
+	return t.CreateContent(spaceKey, ancestorsID, title, content, pagetype)
+}
+
+// ParseLocalTemplateFile text/templateのファイルを読み込む
+// LocalTemplateFuncsの関数が使える
+func ParseLocalTemplateFile(path string) (*template.Template, error) {
+	return template.New(fileio.FileName(path)).Funcs(LocalTemplateFuncs).ParseFiles(path)
+}
+
+// RenderLocalTemplate text/templateでstorage本文を作る
+func RenderLocalTemplate(tmpl *template.Template, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, data)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// CreateContentFromLocalTemplate text/templateで作った本文でコンテンツを作成する
+func (t *Client) CreateContentFromLocalTemplate(
+	tmpl *template.Template,
+	data interface{},
+	spaceKey,
+	ancestorsID,
+	title string,
+	pagetype PageType,
+) (*http.Response, error) {
+	content, err := RenderLocalTemplate(tmpl, data)
+	if err != nil {
+		return nil, err
+	}
+	return t.CreateContent(spaceKey, ancestorsID, title, content, pagetype)
+}
@@ -0,0 +1,79 @@
+package confluence
+
+import (
+	"net/http"
+
+	"github.com/naminomare/gogutil/atlassian/rest"
+)
+
+// PageTree ページとその子ページ
+type PageTree struct {
+	Content  Content     `json:"content"`
+	Children []*PageTree `json:"children,omitempty"`
+}
+
+// FetchChildPages pageIDの直下の子ページを取得する
+func (t *Client) FetchChildPages(pageID string, start, limit int) (*ContentResults, error) {
+	var res ContentResults
+	err := t.rest.DoDecode(
+		http.MethodGet,
+		rest.Pathf("/rest/api/content/%s/child/page", pageID),
+		rest.SetPaging(nil, "start", start, "limit", limit),
+		nil,
+		&res,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// FetchAllChildPages pageIDの直下の子ページをすべて取得する
+func (t *Client) FetchAllChildPages(pageID string) ([]Content, error) {
+	return rest.FetchAll(0, func(start, limit int) ([]Content, bool, error) {
+		res, err := t.FetchChildPages(pageID, start, limit)
+		if err != nil {
+			return nil, false, err
+		}
+		return res.Results, res.Links["next"] != "", nil
+	})
+}
+
+// FetchPageTree pageIDから子ページをたどってツリーにする
+// depthが0の場合はpageIDのページだけ、負の場合は制限しない
+func (t *Client) FetchPageTree(pageID string, depth int) (*PageTree, error) {
+	resp, err := t.FetchPageByID(pageID)
+	if err != nil {
+		return nil, err
+	}
+	var root Content
+	err = decodeResponse(resp, &root)
+	if err != nil {
+		return nil, err
+	}
+	ret := &PageTree{Content: root}
+	err = t.fetchChildTree(ret, depth)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (t *Client) fetchChildTree(parent *PageTree, depth int) error {
+	if depth == 0 {
+		return nil
+	}
+	children, err := t.FetchAllChildPages(parent.Content.ID)
+	if err != nil {
+		return err
+	}
+	for _, v := range children {
+		child := &PageTree{Content: v}
+		err = t.fetchChildTree(child, depth-1)
+		if err != nil {
+			return err
+		}
+		parent.Children = append(parent.Children, child)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package confluence
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/naminomare/gogutil/atlassian/rest"
+)
+
+// DiffOp 差分の種類
+type DiffOp int
+
+const (
+	// DiffEqual 変更なし
+	DiffEqual DiffOp = iota
+	// DiffInsert 追加
+	DiffInsert
+	// DiffDelete 削除
+	DiffDelete
+)
+
+// DiffLine 差分の1行
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
+
+// String unified diff風の1行にする
+func (t DiffLine) String() string {
+	switch t.Op {
+	case DiffInsert:
+		return "+" + t.Text
+	case DiffDelete:
+		return "-" + t.Text
+	}
+	return " " + t.Text
+}
+
+// FetchVersions ページのバージョン一覧を取得する
+// 6.6ではexperimentalのAPIになっている
+func (t *Client) FetchVersions(pageID string, start, limit int) (*VersionResults, error) {
+	query := rest.SetPaging(url.Values{}, "start", start, "limit", limit)
+	var res VersionResults
+	err := t.rest.DoDecode(http.MethodGet, rest.Pathf("/rest/experimental/content/%s/version", pageID), query, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// FetchPageVersion 指定したバージョンのページを本文付きで取得する
+func (t *Client) FetchPageVersion(pageID string, versionNumber int) (*Content, error) {
+	query := url.Values{
+		"status":  {"historical"},
+		"version": {strconv.Itoa(versionNumber)},
+		"expand":  {"body.storage,version,space"},
+	}
+	var res Content
+	err := t.rest.DoDecode(http.MethodGet, rest.Pathf("/rest/api/content/%s", pageID), query, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// RestoreVersion 過去のバージョンを現在のバージョンとして復元する
+func (t *Client) RestoreVersion(pageID string, versionNumber int, message string) (*http.Response, error) {
+	postMap := map[string]interface{}{
+		"operationKey": "restore",
+		"params": map[string]interface{}{
+			"versionNumber": versionNumber,
+			"message":       message,
+			"restoreTitle":  true,
+		},
+	}
+	return t.rest.Do(http.MethodPost, rest.Pathf("/rest/experimental/content/%s/version", pageID), nil, postMap, nil)
+}
+
+// DiffVersions 2つのバージョンのstorage本文の差分を取る
+func (t *Client) DiffVersions(pageID string, fromVersion, toVersion int) ([]DiffLine, error) {
+	from, err := t.FetchPageVersion(pageID, fromVersion)
+	if err != nil {
+		return nil, err
+	}
+	to, err := t.FetchPageVersion(pageID, toVersion)
+	if err != nil {
+		return nil, err
+	}
+	return DiffStorage(from.Body.Storage.Value, to.Body.Storage.Value), nil
+}
+
+// DiffStorage storage形式の本文同士の行単位の差分を返す
+// storage形式は改行が少ないので、タグの切れ目でも行を分ける
+func DiffStorage(from, to string) []DiffLine {
+	return diffLines(splitStorageLines(from), splitStorageLines(to))
+}
+
+func splitStorageLines(storage string) []string {
+	if storage == "" {
+		return nil
+	}
+	storage = strings.ReplaceAll(storage, "\r\n", "\n")
+	storage = strings.ReplaceAll(storage, "><", ">\n<")
+	return strings.Split(storage, "\n")
+}
+
+var (
+	// MaxDiffEdits DiffStorageで探す編集(追加と削除)の数の上限
+	// 超えた場合は違う部分をまとめて削除して追加したものとして返す
+	// 使うメモリは上限の2乗に比例する
+	MaxDiffEdits = 2000
+)
+
+// diffLines Myersのアルゴリズムで差分を取る
+// 先頭と末尾の同じ部分は先に除く
+func diffLines(a, b []string) []DiffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ret []DiffLine
+	for _, v := range a[:prefix] {
+		ret = append(ret, DiffLine{Op: DiffEqual, Text: v})
+	}
+	middle, ok := myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], MaxDiffEdits)
+	if !ok {
+		middle = nil
+		for _, v := range a[prefix : len(a)-suffix] {
+			middle = append(middle, DiffLine{Op: DiffDelete, Text: v})
+		}
+		for _, v := range b[prefix : len(b)-suffix] {
+			middle = append(middle, DiffLine{Op: DiffInsert, Text: v})
+		}
+	}
+	ret = append(ret, middle...)
+	for _, v := range a[len(a)-suffix:] {
+		ret = append(ret, DiffLine{Op: DiffEqual, Text: v})
+	}
+	return ret
+}
+
+// myersDiff 編集の数がmaxEditsを超える場合はfalseを返す
+func myersDiff(a, b []string, maxEdits int) ([]DiffLine, bool) {
+	n, m := len(a), len(b)
+	max := n + m
+	if max > maxEdits {
+		max = maxEdits
+	}
+	// v[k+offset] は対角線kで一番遠くまで進んだ時のaの位置
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] はd回目の探索を始める前のvのうち-d..dの部分
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return myersBacktrack(a, b, trace, d), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// myersBacktrack traceをたどって差分を組み立てる
+func myersBacktrack(a, b []string, trace [][]int, d int) []DiffLine {
+	ret := make([]DiffLine, 0, len(a)+len(b))
+	x, y := len(a), len(b)
+	for ; d > 0; d-- {
+		prev := trace[d]
+		// prev[0]が対角線-d
+		at := func(k int) int { return prev[k+d] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ret = append(ret, DiffLine{Op: DiffEqual, Text: a[x]})
+		}
+		if x == prevX {
+			y--
+			ret = append(ret, DiffLine{Op: DiffInsert, Text: b[y]})
+		} else {
+			x--
+			ret = append(ret, DiffLine{Op: DiffDelete, Text: a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		ret = append(ret, DiffLine{Op: DiffEqual, Text: a[x]})
+	}
+	for i, j := 0, len(ret)-1; i < j; i, j = i+1, j-1 {
+		ret[i], ret[j] = ret[j], ret[i]
+	}
+	return ret
+}
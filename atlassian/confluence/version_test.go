@@ -0,0 +1,121 @@
+package confluence
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	eq := func(s string) DiffLine { return DiffLine{Op: DiffEqual, Text: s} }
+	ins := func(s string) DiffLine { return DiffLine{Op: DiffInsert, Text: s} }
+	del := func(s string) DiffLine { return DiffLine{Op: DiffDelete, Text: s} }
+
+	tests := []struct {
+		name     string
+		a, b     []string
+		maxEdits int
+		want     []DiffLine
+	}{
+		{name: "both empty", want: nil},
+		{name: "from empty", b: []string{"a", "b"}, want: []DiffLine{ins("a"), ins("b")}},
+		{name: "to empty", a: []string{"a", "b"}, want: []DiffLine{del("a"), del("b")}},
+		{name: "identical", a: []string{"a", "b"}, b: []string{"a", "b"}, want: []DiffLine{eq("a"), eq("b")}},
+		{
+			name: "insert in middle",
+			a:    []string{"a", "c"},
+			b:    []string{"a", "b", "c"},
+			want: []DiffLine{eq("a"), ins("b"), eq("c")},
+		},
+		{
+			name: "delete in middle",
+			a:    []string{"a", "b", "c"},
+			b:    []string{"a", "c"},
+			want: []DiffLine{eq("a"), del("b"), eq("c")},
+		},
+		{
+			name: "replace",
+			a:    []string{"a", "b", "c"},
+			b:    []string{"a", "x", "c"},
+			want: []DiffLine{eq("a"), del("b"), ins("x"), eq("c")},
+		},
+		{
+			// 上限を超えたら前後の一致以外は全部置き換える
+			name:     "edit cap fallback",
+			a:        []string{"p", "a", "b", "c", "s"},
+			b:        []string{"p", "x", "b", "y", "s"},
+			maxEdits: 1,
+			want:     []DiffLine{eq("p"), del("a"), del("b"), del("c"), ins("x"), ins("b"), ins("y"), eq("s")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.maxEdits > 0 {
+				old := MaxDiffEdits
+				MaxDiffEdits = tt.maxEdits
+				defer func() { MaxDiffEdits = old }()
+			}
+			got := diffLines(tt.a, tt.b)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("diffLines(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+// 差分から元の2つを組み立て直せて、編集数が最小になっている
+func TestDiffLinesMinimal(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		edits int
+	}{
+		{"abcabba", "cbabac", 5},
+		{"kitten", "sitting", 5},
+		{"abc", "abc", 0},
+		{"", "abc", 3},
+		{"abcdef", "fedcba", 10},
+	}
+	for _, tt := range tests {
+		a := strings.Split(tt.a, "")
+		b := strings.Split(tt.b, "")
+		got := diffLines(a, b)
+		var from, to []string
+		edits := 0
+		for _, v := range got {
+			switch v.Op {
+			case DiffEqual:
+				from = append(from, v.Text)
+				to = append(to, v.Text)
+			case DiffDelete:
+				from = append(from, v.Text)
+				edits++
+			case DiffInsert:
+				to = append(to, v.Text)
+				edits++
+			}
+		}
+		if strings.Join(from, "") != tt.a || strings.Join(to, "") != tt.b {
+			t.Fatalf("%q -> %q: diff does not reproduce inputs: %v", tt.a, tt.b, got)
+		}
+		if edits != tt.edits {
+			t.Fatalf("%q -> %q: %d edits, want %d", tt.a, tt.b, edits, tt.edits)
+		}
+	}
+}
+
+func TestDiffStorage(t *testing.T) {
+	if got := DiffStorage("", ""); len(got) != 0 {
+		t.Fatalf("DiffStorage of empty bodies = %v", got)
+	}
+	got := DiffStorage("<p>a</p><p>b</p>", "<p>a</p><p>c</p>")
+	var changed []string
+	for _, v := range got {
+		if v.Op != DiffEqual {
+			changed = append(changed, v.String())
+		}
+	}
+	want := []string{"-<p>b</p>", "+<p>c</p>"}
+	if !reflect.DeepEqual(changed, want) {
+		t.Fatalf("changed lines = %q, want %q", changed, want)
+	}
+}
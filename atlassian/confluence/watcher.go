@@ -0,0 +1,272 @@
+package confluence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/naminomare/gogutil/atlassian/rest"
+)
+
+// ChangeType Watcherが出すイベントの種類
+type ChangeType string
+
+var (
+	// ChangeCreated 作成された。バージョンが1のもの
+	ChangeCreated ChangeType = "created"
+
+	// ChangeUpdated 更新された
+	ChangeUpdated ChangeType = "updated"
+
+	// DefaultWatchInterval WatcherOptions.Intervalが0の時に使う
+	DefaultWatchInterval = time.Minute
+)
+
+// ChangeEvent Watcherが見つけた変更
+type ChangeEvent struct {
+	Type    ChangeType
+	Content Content
+	// Time 変更された日時
+	Time time.Time
+}
+
+// WatcherOptions Watcherの設定
+type WatcherOptions struct {
+	// CQL lastmodifiedの条件にandでつなぐ条件。例: space = "DS" and type = page
+	CQL string
+	// Interval 検索する間隔。0の場合はDefaultWatchInterval
+	// HTTPWaitClientの間隔より短くしても、リクエストはHTTPWaitClientの間隔で待たされる
+	Interval time.Duration
+	// CheckpointFile どこまで通知したかを保存するファイル。空の場合は保存しない
+	CheckpointFile string
+	// Since CheckpointFileが無い時にこれ以降の変更を通知する。ゼロ値の場合は今
+	Since time.Time
+	// Location CQLの日時のタイムゾーン。Confluenceのユーザーのタイムゾーンに合わせる。nilの場合はtime.Local
+	Location *time.Location
+	// Limit 1回の検索で取得する件数。0の場合はrest.DefaultPageLimit
+	Limit int
+	// OnError 検索に失敗した時に呼ばれる。失敗しても次の間隔でやり直す
+	OnError func(err error)
+}
+
+// Watcher SearchPageByCQLを定期的に実行して変更を通知する
+// webhookが使えない環境向け。削除はlastmodifiedで見つからないので通知できない
+type Watcher struct {
+	client     *Client
+	opts       WatcherOptions
+	events     chan ChangeEvent
+	checkpoint watchCheckpoint
+}
+
+// watchCheckpoint CheckpointFileの中身
+// CQLは分の精度しかないので、Timeの分から検索して、その分に通知した変更はSeenで除く
+type watchCheckpoint struct {
+	Time time.Time `json:"time"`
+	// Seen Timeと同じ分に通知した変更。キーはchangeKey
+	Seen map[string]time.Time `json:"seen"`
+}
+
+// NewWatcher Watcherを返す。CheckpointFileがある場合は読み込む
+func (t *Client) NewWatcher(opts WatcherOptions) (*Watcher, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultWatchInterval
+	}
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	ret := &Watcher{
+		client: t,
+		opts:   opts,
+		events: make(chan ChangeEvent),
+		checkpoint: watchCheckpoint{
+			Time: opts.Since,
+			Seen: map[string]time.Time{},
+		},
+	}
+	if ret.checkpoint.Time.IsZero() {
+		ret.checkpoint.Time = time.Now()
+	}
+	if opts.CheckpointFile == "" {
+		return ret, nil
+	}
+	bin, err := os.ReadFile(opts.CheckpointFile)
+	if os.IsNotExist(err) {
+		return ret, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(bin, &ret.checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	if ret.checkpoint.Seen == nil {
+		ret.checkpoint.Seen = map[string]time.Time{}
+	}
+	return ret, nil
+}
+
+// Events 変更が送られるチャンネル。Runが終わると閉じる
+func (t *Watcher) Events() <-chan ChangeEvent {
+	return t.events
+}
+
+// Checkpoint どこまで通知したか
+func (t *Watcher) Checkpoint() time.Time {
+	return t.checkpoint.Time
+}
+
+// Run ctxが終わるまでIntervalごとに検索して、見つけた変更をEventsに送る
+// 受け取られた変更だけCheckpointFileに保存するので、途中で止めても再開した時に漏れない
+// ctxが終わった時はctx.Err()を返す。保存にも失敗した場合は両方をerrors.Joinで返す。Runは1回しか呼べない
+func (t *Watcher) Run(ctx context.Context) error {
+	defer close(t.events)
+	for {
+		events, err := t.poll(ctx)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			if t.opts.OnError != nil {
+				t.opts.OnError(err)
+			}
+		}
+		for i, ev := range events {
+			select {
+			case t.events <- ev:
+				t.checkpoint.advance(ev)
+			case <-ctx.Done():
+				if i > 0 {
+					if err := t.save(); err != nil {
+						return errors.Join(ctx.Err(), err)
+					}
+				}
+				return ctx.Err()
+			}
+		}
+		if len(events) > 0 {
+			err = t.save()
+			if err != nil {
+				return err
+			}
+		}
+
+		timer := time.NewTimer(t.opts.Interval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// poll チェックポイント以降の変更を古い順に返す
+// 作成と更新を区別するのにバージョンが要るので、content.versionをexpandする
+func (t *Watcher) poll(ctx context.Context) ([]ChangeEvent, error) {
+	cql := "lastmodified >= " + QuoteCQL(t.checkpoint.Time.In(t.opts.Location).Format(cqlDateFormat))
+	if t.opts.CQL != "" {
+		cql += " and (" + t.opts.CQL + ")"
+	}
+	cql += " order by lastmodified asc"
+
+	results, err := rest.FetchAllContext(ctx, t.opts.Limit, func(start, limit int) ([]SearchResult, bool, error) {
+		res, err := t.client.SearchContext(ctx, cql, "content.version", start, limit)
+		if err != nil {
+			return nil, false, err
+		}
+		return res.Results, res.Links["next"] != "", nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []ChangeEvent
+	for _, v := range results {
+		ev := ChangeEvent{
+			Type:    ChangeUpdated,
+			Content: v.Content,
+			Time:    parseChangeTime(v),
+		}
+		if ev.Time.IsZero() {
+			ev.Time = t.checkpoint.Time
+		}
+		if v.Content.Version.Number == 1 {
+			ev.Type = ChangeCreated
+		}
+		if _, ok := t.checkpoint.Seen[changeKey(ev)]; ok {
+			continue
+		}
+		ret = append(ret, ev)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Time.Before(ret[j].Time)
+	})
+	return ret, nil
+}
+
+// save CheckpointFileに書き込む。途中で落ちても壊れないように別のファイルに書いてから置き換える
+func (t *Watcher) save() error {
+	if t.opts.CheckpointFile == "" {
+		return nil
+	}
+	bin, err := json.Marshal(t.checkpoint)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(t.opts.CheckpointFile), filepath.Base(t.opts.CheckpointFile)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(bin)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), t.opts.CheckpointFile)
+}
+
+// advance evを通知したことにする
+func (t *watchCheckpoint) advance(ev ChangeEvent) {
+	if ev.Time.After(t.Time) {
+		t.Time = ev.Time
+	}
+	t.Seen[changeKey(ev)] = ev.Time
+	// 検索するのはTimeの分からなので、それより前のものは覚えておかなくていい
+	minute := t.Time.Truncate(time.Minute)
+	for k, v := range t.Seen {
+		if v.Before(minute) {
+			delete(t.Seen, k)
+		}
+	}
+}
+
+// changeKey 同じ変更か判定するキー
+// 検索結果にバージョンが無い場合は日時で区別する
+func changeKey(ev ChangeEvent) string {
+	if ev.Content.Version.Number > 0 {
+		return ev.Content.ID + "@" + strconv.Itoa(ev.Content.Version.Number)
+	}
+	return ev.Content.ID + "@" + ev.Time.Format(time.RFC3339Nano)
+}
+
+// parseChangeTime 変更日時。バージョンの日時が無い場合は検索結果のlastModified
+func parseChangeTime(v SearchResult) time.Time {
+	for _, s := range []string{v.Content.Version.When, v.LastModified} {
+		if when, err := time.Parse(time.RFC3339, s); err == nil {
+			return when
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,81 @@
+package jira
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+
+	"github.com/naminomare/gogutil/atlassian/rest"
+	"github.com/naminomare/gogutil/fileio"
+	"github.com/naminomare/gogutil/network"
+)
+
+// Attachment 課題の添付ファイル
+type Attachment struct {
+	ID       string `json:"id"`
+	Self     string `json:"self"`
+	Filename string `json:"filename"`
+	Author   User   `json:"author"`
+	Created  string `json:"created"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Content  string `json:"content"`
+}
+
+// AddAttachments 課題にファイルを添付する
+func (t *Client) AddAttachments(issueKey string, files []string) ([]Attachment, error) {
+	var readers []io.Reader
+	for _, file := range files {
+		fh, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer fh.Close()
+		readers = append(readers, fh)
+	}
+	return t.AddAttachmentsByIO(issueKey, readers, files)
+}
+
+// AddAttachmentsByIO readerとそれに応じたfilenamesを使って添付する
+// len(readers) != len(filenames) の時は ErrInvalidArgumentsを返す
+func (t *Client) AddAttachmentsByIO(issueKey string, readers []io.Reader, filenames []string) ([]Attachment, error) {
+	if len(readers) != len(filenames) {
+		return nil, ErrInvalidArguments
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for i, reader := range readers {
+		fw, err := w.CreateFormFile("file", fileio.FileName(filenames[i]))
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(fw, reader)
+		if err != nil {
+			return nil, err
+		}
+	}
+	w.Close()
+
+	resp, err := t.rest.Do(
+		http.MethodPost,
+		rest.Pathf("/rest/api/2/issue/%s/attachments", issueKey),
+		nil,
+		&buf,
+		map[string]string{
+			network.ContentType: w.FormDataContentType(),
+			"X-Atlassian-Token": "no-check",
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	var res []Attachment
+	err = rest.DecodeResponse(resp, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
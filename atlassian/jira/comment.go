@@ -0,0 +1,59 @@
+package jira
+
+import (
+	"net/http"
+
+	"github.com/naminomare/gogutil/atlassian/rest"
+)
+
+// Comment 課題のコメント
+type Comment struct {
+	ID           string `json:"id"`
+	Body         string `json:"body"`
+	Author       User   `json:"author"`
+	UpdateAuthor User   `json:"updateAuthor"`
+	Created      string `json:"created"`
+	Updated      string `json:"updated"`
+}
+
+// CommentResults コメントの一覧
+type CommentResults struct {
+	StartAt    int       `json:"startAt"`
+	MaxResults int       `json:"maxResults"`
+	Total      int       `json:"total"`
+	Comments   []Comment `json:"comments"`
+}
+
+// FetchComments 課題のコメントを取得する
+func (t *Client) FetchComments(issueKey string, startAt, maxResults int) (*CommentResults, error) {
+	var res CommentResults
+	err := t.rest.DoDecode(
+		http.MethodGet,
+		rest.Pathf("/rest/api/2/issue/%s/comment", issueKey),
+		rest.SetPaging(nil, "startAt", startAt, "maxResults", maxResults),
+		nil,
+		&res,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// AddComment 課題にコメントする。bodyはwiki記法
+func (t *Client) AddComment(issueKey, body string) (*Comment, error) {
+	var res Comment
+	err := t.rest.DoDecode(
+		http.MethodPost,
+		rest.Pathf("/rest/api/2/issue/%s/comment", issueKey),
+		nil,
+		map[string]string{
+			"body": body,
+		},
+		&res,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
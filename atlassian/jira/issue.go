@@ -0,0 +1,91 @@
+package jira
+
+// Issue 課題
+type Issue struct {
+	ID     string      `json:"id"`
+	Key    string      `json:"key"`
+	Self   string      `json:"self"`
+	Fields IssueFields `json:"fields"`
+}
+
+// IssueFields 課題のフィールドのうちよく使うもの
+type IssueFields struct {
+	Summary     string    `json:"summary"`
+	Description string    `json:"description"`
+	IssueType   IssueType `json:"issuetype"`
+	Project     Project   `json:"project"`
+	Status      Status    `json:"status"`
+	Priority    *Priority `json:"priority"`
+	Assignee    *User     `json:"assignee"`
+	Reporter    *User     `json:"reporter"`
+	Labels      []string  `json:"labels"`
+	FixVersions []Version `json:"fixVersions"`
+	Created     string    `json:"created"`
+	Updated     string    `json:"updated"`
+}
+
+// IssueType 課題タイプ
+type IssueType struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Subtask bool   `json:"subtask"`
+}
+
+// Project プロジェクト
+type Project struct {
+	ID   string `json:"id"`
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+// Status ステータス
+type Status struct {
+	ID             string         `json:"id"`
+	Name           string         `json:"name"`
+	StatusCategory StatusCategory `json:"statusCategory"`
+}
+
+// StatusCategory ステータスのカテゴリ。Keyは"new", "indeterminate", "done"
+type StatusCategory struct {
+	ID   int    `json:"id"`
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+// Priority 優先度
+type Priority struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// User ユーザー
+type User struct {
+	Name         string `json:"name"`
+	Key          string `json:"key"`
+	AccountID    string `json:"accountId"`
+	DisplayName  string `json:"displayName"`
+	EmailAddress string `json:"emailAddress"`
+}
+
+// Version バージョン
+type Version struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Released    bool   `json:"released"`
+	ReleaseDate string `json:"releaseDate"`
+}
+
+// SearchResults JQLの検索結果
+type SearchResults struct {
+	StartAt    int     `json:"startAt"`
+	MaxResults int     `json:"maxResults"`
+	Total      int     `json:"total"`
+	Issues     []Issue `json:"issues"`
+}
+
+// CreatedIssue 作成した課題
+type CreatedIssue struct {
+	ID   string `json:"id"`
+	Key  string `json:"key"`
+	Self string `json:"self"`
+}
@@ -0,0 +1,151 @@
+package jira
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/naminomare/gogutil/atlassian/rest"
+	"github.com/naminomare/gogutil/network"
+)
+
+// https://docs.atlassian.com/software/jira/docs/api/REST/8.5.0/
+// を参考に
+
+var (
+	// ErrInvalidArguments 入力値が不正の時
+	ErrInvalidArguments = errors.New("入力値が不正です")
+
+	// ErrTransitionNotFound 指定した名前のトランジションがない時
+	ErrTransitionNotFound = errors.New("トランジションが見つかりません")
+)
+
+// ResponseError 2xx以外のレスポンスが返ってきた時のエラー
+type ResponseError = rest.ResponseError
+
+// Client Jiraアクセス用クライアント
+type Client struct {
+	rest *rest.Client
+}
+
+// NewClient クライアント作成
+func NewClient(
+	baseURL,
+	serverName,
+	userName,
+	password string,
+) *Client {
+	return &Client{
+		rest: rest.NewBasicAuthClient(baseURL, serverName, userName, password),
+	}
+}
+
+// NewClientWithHTTPClient 設定済みのHTTPWaitClientを使ってクライアント作成
+// 認証やServerName(TLSのSNI)はHTTPWaitClientごとの設定なので、別のホストのクライアントとは共有しない
+// Confluenceと同じ認証や間隔を使う場合はNewClientFromHTTPClientを使う
+func NewClientWithHTTPClient(baseURL string, httpClient *network.HTTPWaitClient) *Client {
+	return &Client{
+		rest: rest.NewClient(baseURL, httpClient),
+	}
+}
+
+// NewClientFromHTTPClient src(confluence.ClientのHTTPClient()など)の認証、間隔、プロキシ、タイムアウトなどを写したクライアント作成
+// serverNameはJiraのもの。srcとは接続や待ち行列を共有しないので、srcの設定を後で変えても影響しない
+func NewClientFromHTTPClient(baseURL, serverName string, src *network.HTTPWaitClient) *Client {
+	return NewClientWithHTTPClient(baseURL, src.Clone(serverName))
+}
+
+// HTTPClient 通信に使っているHTTPWaitClientを返す
+func (t *Client) HTTPClient() *network.HTTPWaitClient {
+	return t.rest.HTTPClient()
+}
+
+// REST 通信に使っているrest.Clientを返す
+func (t *Client) REST() *rest.Client {
+	return t.rest
+}
+
+// FetchIssue キーかIDで課題を取得する
+// fieldsが空の場合はすべてのフィールドを取得する
+func (t *Client) FetchIssue(issueKey string, fields []string) (*Issue, error) {
+	query := url.Values{}
+	if len(fields) > 0 {
+		query.Set("fields", strings.Join(fields, ","))
+	}
+	var res Issue
+	err := t.rest.DoDecode(http.MethodGet, rest.Pathf("/rest/api/2/issue/%s", issueKey), query, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// SearchIssues JQLで課題を検索する
+// maxResultsが0の場合はサーバーのデフォルト
+func (t *Client) SearchIssues(jql string, startAt, maxResults int, fields []string) (*SearchResults, error) {
+	body := map[string]interface{}{
+		"jql":     jql,
+		"startAt": startAt,
+	}
+	if maxResults != 0 {
+		body["maxResults"] = maxResults
+	}
+	if len(fields) > 0 {
+		body["fields"] = fields
+	}
+	var res SearchResults
+	err := t.rest.DoDecode(http.MethodPost, "/rest/api/2/search", nil, body, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// SearchAllIssues JQLで課題を検索して、すべてのページを取得する
+func (t *Client) SearchAllIssues(jql string, fields []string) ([]Issue, error) {
+	return rest.FetchAll(0, func(start, limit int) ([]Issue, bool, error) {
+		res, err := t.SearchIssues(jql, start, limit, fields)
+		if err != nil {
+			return nil, false, err
+		}
+		return res.Issues, res.StartAt+len(res.Issues) < res.Total, nil
+	})
+}
+
+// CreateIssue 課題を作成する
+// extraFieldsはカスタムフィールドなど、summaryなど以外に指定するフィールド
+func (t *Client) CreateIssue(
+	projectKey,
+	issueType,
+	summary,
+	description string,
+	extraFields map[string]interface{},
+) (*CreatedIssue, error) {
+	if projectKey == "" || issueType == "" || summary == "" {
+		return nil, ErrInvalidArguments
+	}
+	fields := map[string]interface{}{
+		"project": map[string]string{
+			"key": projectKey,
+		},
+		"issuetype": map[string]string{
+			"name": issueType,
+		},
+		"summary": summary,
+	}
+	if description != "" {
+		fields["description"] = description
+	}
+	for k, v := range extraFields {
+		fields[k] = v
+	}
+	var res CreatedIssue
+	err := t.rest.DoDecode(http.MethodPost, "/rest/api/2/issue", nil, map[string]interface{}{
+		"fields": fields,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
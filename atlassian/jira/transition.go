@@ -0,0 +1,72 @@
+package jira
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/naminomare/gogutil/atlassian/rest"
+)
+
+// Transition 課題のステータスを変えるトランジション
+type Transition struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// To 遷移先のステータス
+	To Status `json:"to"`
+}
+
+type transitionResults struct {
+	Transitions []Transition `json:"transitions"`
+}
+
+// FetchTransitions 課題で今使えるトランジションを取得する
+func (t *Client) FetchTransitions(issueKey string) ([]Transition, error) {
+	var res transitionResults
+	err := t.rest.DoDecode(
+		http.MethodGet,
+		rest.Pathf("/rest/api/2/issue/%s/transitions", issueKey),
+		url.Values{"expand": {"transitions.fields"}},
+		nil,
+		&res,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return res.Transitions, nil
+}
+
+// TransitionIssue トランジションIDで課題のステータスを変える
+// fieldsは画面で入力が必要なフィールド。resolutionなど
+func (t *Client) TransitionIssue(issueKey, transitionID string, fields map[string]interface{}) error {
+	body := map[string]interface{}{
+		"transition": map[string]string{
+			"id": transitionID,
+		},
+	}
+	if len(fields) > 0 {
+		body["fields"] = fields
+	}
+	return t.rest.DoDecode(
+		http.MethodPost,
+		rest.Pathf("/rest/api/2/issue/%s/transitions", issueKey),
+		nil,
+		body,
+		nil,
+	)
+}
+
+// TransitionIssueByName トランジション名か遷移先のステータス名で課題のステータスを変える
+// 大文字小文字は区別しない。見つからない場合はErrTransitionNotFound
+func (t *Client) TransitionIssueByName(issueKey, name string, fields map[string]interface{}) error {
+	transitions, err := t.FetchTransitions(issueKey)
+	if err != nil {
+		return err
+	}
+	for _, v := range transitions {
+		if strings.EqualFold(v.Name, name) || strings.EqualFold(v.To.Name, name) {
+			return t.TransitionIssue(issueKey, v.ID, fields)
+		}
+	}
+	return ErrTransitionNotFound
+}
@@ -0,0 +1,61 @@
+package rest
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+var (
+	// DefaultPageLimit FetchAllで1回に取得する件数
+	DefaultPageLimit = 25
+)
+
+// FetchFunc startからlimit件取得する。続きがある場合はmoreをtrueにする
+type FetchFunc[T any] func(start, limit int) (items []T, more bool, err error)
+
+// FetchAll fetchを繰り返してすべて取得する
+// limitが0以下の場合はDefaultPageLimit
+func FetchAll[T any](limit int, fetch FetchFunc[T]) ([]T, error) {
+	return FetchAllContext(context.Background(), limit, fetch)
+}
+
+// FetchAllContext ctxが終わるまでfetchを繰り返してすべて取得する
+// ctxが終わった時はそれまでに取得したものとctx.Err()を返す
+func FetchAllContext[T any](ctx context.Context, limit int, fetch FetchFunc[T]) ([]T, error) {
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+	var ret []T
+	start := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return ret, err
+		}
+		items, more, err := fetch(start, limit)
+		if err != nil {
+			return ret, err
+		}
+		ret = append(ret, items...)
+		// 件数が0なのに続きがあると言うサーバーで止まらなくならないように
+		if !more || len(items) == 0 {
+			return ret, nil
+		}
+		start += len(items)
+	}
+}
+
+// SetPaging queryにstartとlimitを入れる。0の場合は入れない
+// startKey, limitKeyは製品ごとに違う。Confluenceは"start", "limit"、Jiraは"startAt", "maxResults"
+func SetPaging(query url.Values, startKey string, start int, limitKey string, limit int) url.Values {
+	if query == nil {
+		query = url.Values{}
+	}
+	if start != 0 {
+		query.Set(startKey, strconv.Itoa(start))
+	}
+	if limit != 0 {
+		query.Set(limitKey, strconv.Itoa(limit))
+	}
+	return query
+}
@@ -0,0 +1,271 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/naminomare/gogutil/network"
+)
+
+// Atlassian製品(Confluence, Jira, Bitbucket)のREST APIで共通の部分
+// 各製品のクライアントはこれを使って薄く作る
+
+var (
+	// DefaultIntervalMS NewBasicAuthClientなどで作るHTTPWaitClientの間隔
+	DefaultIntervalMS = 1000
+
+	// MaxErrorBodySize 2xx以外の時にResponseError.Bodyに読むbodyの上限
+	MaxErrorBodySize int64 = 64 << 10
+)
+
+// Client REST APIのクライアント
+type Client struct {
+	baseURL    string
+	httpClient *network.HTTPWaitClient
+}
+
+// NewClient 設定済みのHTTPWaitClientを使ってクライアント作成
+// baseURLはコンテキストパスまで含める。例: https://example.com/confluence
+func NewClient(baseURL string, httpClient *network.HTTPWaitClient) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// NewBasicAuthClient ユーザー名とパスワードで認証するクライアント作成
+func NewBasicAuthClient(baseURL, serverName, userName, password string) *Client {
+	httpClient := network.NewHTTPWaitClient(DefaultIntervalMS, serverName)
+	httpClient.SetAuth(userName, password)
+	return NewClient(baseURL, httpClient)
+}
+
+// NewTokenClient パーソナルアクセストークンで認証するクライアント作成
+func NewTokenClient(baseURL, serverName, token string) *Client {
+	httpClient := network.NewHTTPWaitClient(DefaultIntervalMS, serverName)
+	httpClient.SetBearerToken(token)
+	return NewClient(baseURL, httpClient)
+}
+
+// BaseURL baseURLを返す
+func (t *Client) BaseURL() string {
+	return t.baseURL
+}
+
+// HTTPClient 通信に使っているHTTPWaitClientを返す
+func (t *Client) HTTPClient() *network.HTTPWaitClient {
+	return t.httpClient
+}
+
+// Pathf formatの%sをエスケープしたargsで置き換える
+// 例: Pathf("/rest/api/content/%s/child/attachment", pageID)
+func Pathf(format string, args ...interface{}) string {
+	escaped := make([]interface{}, len(args))
+	for i, v := range args {
+		escaped[i] = url.PathEscape(fmt.Sprint(v))
+	}
+	return fmt.Sprintf(format, escaped...)
+}
+
+// URL baseURLにpathとqueryをつなげる
+// pathがhttp://などから始まる場合はbaseURLをつけない
+func (t *Client) URL(path string, query url.Values) string {
+	ret := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		ret = t.baseURL + path
+	}
+	if len(query) > 0 {
+		if strings.Contains(ret, "?") {
+			ret += "&"
+		} else {
+			ret += "?"
+		}
+		ret += query.Encode()
+	}
+	return ret
+}
+
+// Do リクエストする
+// bodyがio.Readerの場合はそのまま送る。nil以外はjsonにして送る
+func (t *Client) Do(
+	method,
+	path string,
+	query url.Values,
+	body interface{},
+	header map[string]string,
+) (*http.Response, error) {
+	return t.DoContext(context.Background(), method, path, query, body, header)
+}
+
+// DoContext ctxを使ってリクエストする。ctxが終わると待ち行列や通信を中断する
+func (t *Client) DoContext(
+	ctx context.Context,
+	method,
+	path string,
+	query url.Values,
+	body interface{},
+	header map[string]string,
+) (*http.Response, error) {
+	h := map[string]string{
+		"Accept": network.ApplicationJSON,
+	}
+	var reader io.Reader
+	switch v := body.(type) {
+	case nil:
+	case io.Reader:
+		reader = v
+	default:
+		bin, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(bin)
+		h[network.ContentType] = network.ApplicationJSON
+	}
+	for k, v := range header {
+		h[k] = v
+	}
+	return t.httpClient.DoRequestContext(ctx, method, t.URL(path, query), reader, h)
+}
+
+// DoDecode Doしてレスポンスをvにデコードする
+// vがnilの場合はbodyを捨てる。2xx以外の時は*ResponseErrorを返す
+func (t *Client) DoDecode(
+	method,
+	path string,
+	query url.Values,
+	body interface{},
+	v interface{},
+) error {
+	return t.DoDecodeContext(context.Background(), method, path, query, body, v)
+}
+
+// DoDecodeContext ctxを使ってDoDecodeする
+func (t *Client) DoDecodeContext(
+	ctx context.Context,
+	method,
+	path string,
+	query url.Values,
+	body interface{},
+	v interface{},
+) error {
+	resp, err := t.DoContext(ctx, method, path, query, body, nil)
+	if err != nil {
+		return err
+	}
+	return DecodeResponse(resp, v)
+}
+
+// ResponseError 2xx以外のレスポンスが返ってきた時のエラー
+type ResponseError struct {
+	StatusCode int
+	Body       string
+	// Messages bodyから読み取れたエラーメッセージ
+	Messages []string
+}
+
+func (t *ResponseError) Error() string {
+	ret := strconv.Itoa(t.StatusCode) + " " + http.StatusText(t.StatusCode)
+	if len(t.Messages) > 0 {
+		return ret + ": " + strings.Join(t.Messages, "; ")
+	}
+	return ret + ": " + t.Body
+}
+
+// StatusCode errが*ResponseErrorの場合はそのステータスコード。違う場合は0
+func StatusCode(err error) int {
+	var rerr *ResponseError
+	if errors.As(err, &rerr) {
+		return rerr.StatusCode
+	}
+	return 0
+}
+
+// DecodeResponse respのbodyをvにデコードする。2xx以外の時は*ResponseErrorを返す
+// bodyはnetwork.DefaultMaxJSONSizeまで、2xx以外のbodyはMaxErrorBodySizeまでしか読まない
+func DecodeResponse(resp *http.Response, v interface{}) error {
+	if resp.StatusCode < 200 || 300 <= resp.StatusCode {
+		defer resp.Body.Close()
+		bin, err := io.ReadAll(io.LimitReader(resp.Body, MaxErrorBodySize))
+		if err != nil {
+			return err
+		}
+		return &ResponseError{
+			StatusCode: resp.StatusCode,
+			Body:       string(bin),
+			Messages:   errorMessages(bin),
+		}
+	}
+	if v == nil || resp.StatusCode == http.StatusNoContent || resp.ContentLength == 0 {
+		// 接続を使い回せるように少しだけ読み捨てる
+		io.Copy(io.Discard, io.LimitReader(resp.Body, MaxErrorBodySize))
+		resp.Body.Close()
+		return nil
+	}
+	raw, err := network.DecodeJSONWithLimit[json.RawMessage](resp, network.DefaultMaxJSONSize)
+	if errors.Is(err, io.EOF) {
+		// Content-Lengthが無い空のbody
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(*raw, v)
+}
+
+// errorBody 製品ごとのエラーの形式
+type errorBody struct {
+	// Confluence
+	Message string `json:"message"`
+	// Jira
+	ErrorMessages []string `json:"errorMessages"`
+	// Jiraはmap、Bitbucketは配列
+	Errors json.RawMessage `json:"errors"`
+}
+
+func errorMessages(bin []byte) []string {
+	var body errorBody
+	if json.Unmarshal(bin, &body) != nil {
+		return nil
+	}
+	var ret []string
+	if body.Message != "" {
+		ret = append(ret, body.Message)
+	}
+	ret = append(ret, body.ErrorMessages...)
+
+	var fields map[string]string
+	if json.Unmarshal(body.Errors, &fields) == nil {
+		keys := make([]string, 0, len(fields))
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			ret = append(ret, k+": "+fields[k])
+		}
+	}
+	var list []struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body.Errors, &list) == nil {
+		for _, v := range list {
+			if v.Message != "" {
+				ret = append(ret, v.Message)
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"strconv"
+	"strings"
+
+	"github.com/naminomare/gogutil/atlassian/confluence"
+	"github.com/naminomare/gogutil/atlassian/rest"
+)
+
+var (
+	attachmentHeaders = []string{"ID", "MEDIA TYPE", "SIZE", "VERSION", "TITLE"}
+
+	// errDownloadFailed ダウンロードに失敗したファイルがある時
+	errDownloadFailed = errors.New("ダウンロードに失敗したファイルがあります")
+)
+
+func attachmentRow(a confluence.AttachmentFetchResult) []string {
+	return []string{
+		a.ID,
+		a.MediaType(),
+		strconv.FormatInt(int64(a.Extensions.FileSize), 10),
+		strconv.Itoa(a.Version.Number),
+		a.Title,
+	}
+}
+
+// filterFlags 添付ファイルの絞り込みのフラグ
+func filterFlags(fs *flag.FlagSet) func() confluence.AttachmentFilter {
+	mediaTypes := fs.String("media-type", "", "メディアタイプ。カンマ区切り、image/*のようなパターンも使える")
+	name := fs.String("name", "", "ファイル名のglob")
+	label := fs.String("label", "", "ラベル")
+	return func() confluence.AttachmentFilter {
+		ret := confluence.AttachmentFilter{
+			NamePattern: *name,
+			Label:       *label,
+		}
+		if *mediaTypes != "" {
+			ret.MediaTypes = strings.Split(*mediaTypes, ",")
+		}
+		return ret
+	}
+}
+
+func attachmentList(env *environment, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	attachments, err := env.client.FetchAllAttachments(args[0])
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, v := range attachments {
+		rows = append(rows, attachmentRow(v))
+	}
+	return env.out.print(attachments, attachmentHeaders, rows)
+}
+
+func attachmentUpload(env *environment, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	resp, err := env.client.AddAttachments(args[0], args[1:])
+	if err != nil {
+		return err
+	}
+	var res confluence.AttachmentResults
+	err = rest.DecodeResponse(resp, &res)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, v := range res.Results {
+		rows = append(rows, attachmentRow(v))
+	}
+	return env.out.print(res.Results, attachmentHeaders, rows)
+}
+
+func attachmentDownload(env *environment, args []string) error {
+	fs := newFlagSet("attachment download", env.stderr)
+	filter := filterFlags(fs)
+	concurrency := fs.Int("concurrency", confluence.DefaultDownloadConcurrency, "同時にダウンロードする数")
+	resume := fs.Bool("resume", false, "途中までダウンロードしたファイルの続きから再開する")
+	skipExisting := fs.Bool("skip-existing", false, "同じサイズのファイルがある場合はダウンロードしない")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() < 1 || 2 < fs.NArg() {
+		return errUsage
+	}
+	dir := "."
+	if fs.NArg() == 2 {
+		dir = fs.Arg(1)
+	}
+
+	results, err := env.client.DownloadAttachmentsWithOptions(fs.Arg(0), dir, confluence.DownloadOptions{
+		Concurrency:  *concurrency,
+		Resume:       *resume,
+		SkipExisting: *skipExisting,
+		Filter:       filter(),
+	})
+	if err != nil {
+		return err
+	}
+
+	type downloaded struct {
+		ID      string `json:"id"`
+		Title   string `json:"title"`
+		Path    string `json:"path"`
+		Size    int64  `json:"size"`
+		Skipped bool   `json:"skipped"`
+		Resumed bool   `json:"resumed"`
+		Error   string `json:"error,omitempty"`
+	}
+	var list []downloaded
+	var rows [][]string
+	failed := false
+	for _, v := range results {
+		d := downloaded{
+			ID:      v.Attachment.ID,
+			Title:   v.Attachment.Title,
+			Path:    v.Path,
+			Size:    v.Size,
+			Skipped: v.Skipped,
+			Resumed: v.Resumed,
+		}
+		status := "ok"
+		switch {
+		case v.Err != nil:
+			d.Error = v.Err.Error()
+			status = "error: " + d.Error
+			failed = true
+		case v.Skipped:
+			status = "skipped"
+		case v.Resumed:
+			status = "resumed"
+		}
+		list = append(list, d)
+		rows = append(rows, []string{d.ID, strconv.FormatInt(d.Size, 10), status, d.Path})
+	}
+	err = env.out.print(list, []string{"ID", "SIZE", "STATUS", "PATH"}, rows)
+	if err != nil {
+		return err
+	}
+	if failed {
+		return errDownloadFailed
+	}
+	return nil
+}
+
+func attachmentMove(env *environment, args []string) error {
+	fs := newFlagSet("attachment move", env.stderr)
+	filter := filterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != 2 {
+		return errUsage
+	}
+	resps, err := env.client.MoveAttachmentsFromPageWithFilter(fs.Arg(0), fs.Arg(1), filter())
+	if err != nil {
+		return err
+	}
+	// デコードに失敗して途中で返っても残りのbodyを閉じる
+	for _, resp := range resps {
+		defer resp.Body.Close()
+	}
+	var moved []confluence.AttachmentFetchResult
+	var rows [][]string
+	for _, resp := range resps {
+		var a confluence.AttachmentFetchResult
+		err = rest.DecodeResponse(resp, &a)
+		if err != nil {
+			return err
+		}
+		moved = append(moved, a)
+		rows = append(rows, attachmentRow(a))
+	}
+	return env.out.print(moved, attachmentHeaders, rows)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/naminomare/gogutil/atlassian/confluence"
+	"github.com/naminomare/gogutil/network"
+)
+
+var (
+	// errNoBaseURL ベースURLが設定されていない時
+	errNoBaseURL = errors.New("ベースURLが設定されていません。-base-urlかCONFLUENCE_BASE_URLで指定してください")
+
+	// defaultIntervalMS リクエストの間隔
+	defaultIntervalMS = 1000
+)
+
+// config 接続の設定
+type config struct {
+	BaseURL    string `json:"baseUrl"`
+	ServerName string `json:"serverName"`
+	User       string `json:"user"`
+	Password   string `json:"password"`
+	// Token パーソナルアクセストークン。空でない場合はUser, Passwordより優先する
+	Token      string `json:"token"`
+	IntervalMS *int   `json:"intervalMs"`
+	// Output "table"か"json"
+	Output string `json:"output"`
+}
+
+// configFlags グローバルフラグ
+type configFlags struct {
+	fs         *flag.FlagSet
+	configPath *string
+	values     config
+	intervalMS *int
+}
+
+// configEnv 環境変数と設定の対応
+var configEnv = []struct {
+	name string
+	set  func(cfg *config, v string) error
+}{
+	{"CONFLUENCE_BASE_URL", func(cfg *config, v string) error { cfg.BaseURL = v; return nil }},
+	{"CONFLUENCE_SERVER_NAME", func(cfg *config, v string) error { cfg.ServerName = v; return nil }},
+	{"CONFLUENCE_USER", func(cfg *config, v string) error { cfg.User = v; return nil }},
+	{"CONFLUENCE_PASSWORD", func(cfg *config, v string) error { cfg.Password = v; return nil }},
+	{"CONFLUENCE_TOKEN", func(cfg *config, v string) error { cfg.Token = v; return nil }},
+	{"CONFLUENCE_INTERVAL_MS", func(cfg *config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		cfg.IntervalMS = &n
+		return nil
+	}},
+	{"CONFLUENCE_OUTPUT", func(cfg *config, v string) error { cfg.Output = v; return nil }},
+}
+
+// configPathEnv 設定ファイルのパスの環境変数
+var configPathEnv = "GOGUTIL_CONFLUENCE_CONFIG"
+
+func configEnvNames() []string {
+	ret := []string{configPathEnv}
+	for _, v := range configEnv {
+		ret = append(ret, v.name)
+	}
+	return ret
+}
+
+func registerConfigFlags(fs *flag.FlagSet) *configFlags {
+	ret := &configFlags{fs: fs}
+	ret.configPath = fs.String("config", "", "設定ファイル(json)のパス。省略時は"+configPathEnv+"かユーザー設定ディレクトリのgogutil-confluence/config.json")
+	fs.StringVar(&ret.values.BaseURL, "base-url", "", "ConfluenceのベースURL。例: https://example.com/confluence")
+	fs.StringVar(&ret.values.ServerName, "server-name", "", "TLSのサーバー名")
+	fs.StringVar(&ret.values.User, "user", "", "ユーザー名")
+	fs.StringVar(&ret.values.Password, "password", "", "パスワード")
+	fs.StringVar(&ret.values.Token, "token", "", "パーソナルアクセストークン")
+	ret.intervalMS = fs.Int("interval-ms", defaultIntervalMS, "リクエストの間隔(ミリ秒)")
+	fs.StringVar(&ret.values.Output, "output", "", "出力形式。tableかjson")
+	return ret
+}
+
+// loadConfig 設定ファイル、環境変数、フラグの順に上書きする
+func loadConfig(flags *configFlags) (*config, error) {
+	cfg := &config{}
+
+	path := *flags.configPath
+	explicit := path != ""
+	if path == "" {
+		path = os.Getenv(configPathEnv)
+		explicit = path != ""
+	}
+	if path == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			path = filepath.Join(dir, "gogutil-confluence", "config.json")
+		}
+	}
+	if path != "" {
+		bin, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			err = json.Unmarshal(bin, cfg)
+			if err != nil {
+				return nil, errors.New(path + ": " + err.Error())
+			}
+		case explicit || !errors.Is(err, os.ErrNotExist):
+			return nil, err
+		}
+	}
+
+	for _, v := range configEnv {
+		if s := os.Getenv(v.name); s != "" {
+			err := v.set(cfg, s)
+			if err != nil {
+				return nil, errors.New(v.name + ": " + err.Error())
+			}
+		}
+	}
+
+	flags.fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "base-url":
+			cfg.BaseURL = flags.values.BaseURL
+		case "server-name":
+			cfg.ServerName = flags.values.ServerName
+		case "user":
+			cfg.User = flags.values.User
+		case "password":
+			cfg.Password = flags.values.Password
+		case "token":
+			cfg.Token = flags.values.Token
+		case "interval-ms":
+			cfg.IntervalMS = flags.intervalMS
+		case "output":
+			cfg.Output = flags.values.Output
+		}
+	})
+	if cfg.IntervalMS == nil {
+		cfg.IntervalMS = &defaultIntervalMS
+	}
+	return cfg, nil
+}
+
+func (t *config) newClient() (*confluence.Client, error) {
+	if t.BaseURL == "" {
+		return nil, errNoBaseURL
+	}
+	httpClient := network.NewHTTPWaitClient(*t.IntervalMS, t.ServerName)
+	if t.Token != "" {
+		httpClient.SetBearerToken(t.Token)
+	} else {
+		httpClient.SetAuth(t.User, t.Password)
+	}
+	return confluence.NewClientWithHTTPClient(t.BaseURL, httpClient), nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/naminomare/gogutil/atlassian/confluence"
+)
+
+func printLabels(env *environment, contentID string) error {
+	labels, err := env.client.FetchLabels(contentID)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, v := range labels {
+		rows = append(rows, []string{v.Prefix, v.Name})
+	}
+	return env.out.print(labels, []string{"PREFIX", "NAME"}, rows)
+}
+
+func labelList(env *environment, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	return printLabels(env, args[0])
+}
+
+func labelAdd(env *environment, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	err := env.client.AddLabels(args[0], args[1:])
+	if err != nil {
+		return err
+	}
+	return printLabels(env, args[0])
+}
+
+func labelRemove(env *environment, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	err := env.client.RemoveLabel(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	return printLabels(env, args[0])
+}
+
+func tree(env *environment, args []string) error {
+	fs := newFlagSet("tree", env.stderr)
+	depth := fs.Int("depth", -1, "たどる深さ。負の場合は制限しない")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+	root, err := env.client.FetchPageTree(fs.Arg(0), *depth)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	var walk func(node *confluence.PageTree, level int)
+	walk = func(node *confluence.PageTree, level int) {
+		rows = append(rows, []string{
+			node.Content.ID,
+			strconv.Itoa(node.Content.Version.Number),
+			strings.Repeat("  ", level) + node.Content.Title,
+		})
+		for _, v := range node.Children {
+			walk(v, level+1)
+		}
+	}
+	walk(root, 0)
+	return env.out.print(root, []string{"ID", "VERSION", "TITLE"}, rows)
+}
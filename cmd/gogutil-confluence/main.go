@@ -0,0 +1,148 @@
+// gogutil-confluence confluence.Clientを使ってConfluenceを操作するコマンド
+//
+//	gogutil-confluence [global flags] <command> [flags] [args]
+//
+// 設定はフラグ、環境変数、設定ファイルの順に優先する。詳しくは -h を参照
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/naminomare/gogutil/atlassian/confluence"
+)
+
+// command サブコマンド
+type command struct {
+	usage string
+	run   func(env *environment, args []string) error
+}
+
+// environment サブコマンドに渡すもの
+type environment struct {
+	client *confluence.Client
+	out    *printer
+	stdin  io.Reader
+	// stderr サブコマンドのフラグのエラーや-hの出力先
+	stderr io.Writer
+}
+
+var (
+	// errUsage 引数が足りない時など。使い方を表示する
+	errUsage = errors.New("引数が不正です")
+
+	commands = map[string]command{
+		"page get":            {"page get [-body] (<id> | -space KEY -title TITLE)", pageGet},
+		"page create":         {"page create -space KEY [-parent ID] [-blog] -title TITLE (-body STORAGE | -file PATH)", pageCreate},
+		"page update":         {"page update [-title TITLE] (-body STORAGE | -file PATH) <id>", pageUpdate},
+		"page move":           {"page move <id> <parentID>", pageMove},
+		"page delete":         {"page delete <id>", pageDelete},
+		"search":              {"search [-start N] [-limit N] <cql>", search},
+		"attachment list":     {"attachment list <pageID>", attachmentList},
+		"attachment upload":   {"attachment upload <pageID> <file>...", attachmentUpload},
+		"attachment download": {"attachment download [-media-type TYPE] [-name GLOB] [-label LABEL] [-concurrency N] [-resume] [-skip-existing] <pageID> [dir]", attachmentDownload},
+		"attachment move":     {"attachment move [-media-type TYPE] [-name GLOB] [-label LABEL] <fromPageID> <toPageID>", attachmentMove},
+		"label list":          {"label list <contentID>", labelList},
+		"label add":           {"label add <contentID> <label>...", labelAdd},
+		"label remove":        {"label remove <contentID> <label>", labelRemove},
+		"tree":                {"tree [-depth N] <pageID>", tree},
+	}
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("gogutil-confluence", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	flags := registerConfigFlags(fs)
+	fs.Usage = func() {
+		printUsage(fs, stderr)
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	name, cmd, rest, ok := findCommand(fs.Args())
+	if !ok {
+		printUsage(fs, stderr)
+		return 2
+	}
+
+	cfg, err := loadConfig(flags)
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return 1
+	}
+	client, err := cfg.newClient()
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return 1
+	}
+	out, err := newPrinter(cfg.Output, stdout)
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return 2
+	}
+
+	err = cmd.run(&environment{client: client, out: out, stdin: stdin, stderr: stderr}, rest)
+	if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(stderr, "usage: gogutil-confluence [global flags]", cmd.usage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", name+":", err)
+		return 1
+	}
+	return 0
+}
+
+// findCommand "page get"のような2語のコマンドを先に探す
+func findCommand(args []string) (string, command, []string, bool) {
+	if len(args) >= 2 {
+		name := args[0] + " " + args[1]
+		if cmd, ok := commands[name]; ok {
+			return name, cmd, args[2:], true
+		}
+	}
+	if len(args) >= 1 {
+		if cmd, ok := commands[args[0]]; ok {
+			return args[0], cmd, args[1:], true
+		}
+	}
+	return "", command{}, nil, false
+}
+
+func printUsage(fs *flag.FlagSet, w io.Writer) {
+	fmt.Fprintln(w, "usage: gogutil-confluence [global flags] <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	names := make([]string, 0, len(commands))
+	for k := range commands {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, v := range names {
+		fmt.Fprintln(w, "  "+commands[v].usage)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "global flags:")
+	fs.PrintDefaults()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "environment variables:")
+	fmt.Fprintln(w, "  "+strings.Join(configEnvNames(), ", "))
+}
+
+// newFlagSet サブコマンド用のFlagSet
+// フラグのエラーや-hのフラグ一覧はoutputに出す
+func newFlagSet(name string, output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	return fs
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+var (
+	// errUnknownOutput -outputが不正な時
+	errUnknownOutput = errors.New("出力形式はtableかjsonです")
+)
+
+// printer 結果をjsonか表で出力する
+type printer struct {
+	json bool
+	w    io.Writer
+}
+
+func newPrinter(format string, w io.Writer) (*printer, error) {
+	switch format {
+	case "", "table":
+		return &printer{w: w}, nil
+	case "json":
+		return &printer{json: true, w: w}, nil
+	}
+	return nil, errUnknownOutput
+}
+
+// print jsonの時はvを、表の時はheadersとrowsを出力する
+func (t *printer) print(v interface{}, headers []string, rows [][]string) error {
+	if t.json {
+		enc := json.NewEncoder(t.w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(t.w, 0, 4, 2, ' ', 0)
+	if len(headers) > 0 {
+		fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	}
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, c := range row {
+			// タブと改行は表が崩れるので空白にする
+			cells[i] = strings.NewReplacer("\t", " ", "\n", " ", "\r", "").Replace(c)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+// printText 表の時だけtextを出力する。ページの本文など
+func (t *printer) printText(text string) {
+	if !t.json {
+		fmt.Fprintln(t.w, text)
+	}
+}
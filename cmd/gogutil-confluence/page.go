@@ -0,0 +1,233 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/naminomare/gogutil/atlassian/confluence"
+	"github.com/naminomare/gogutil/atlassian/rest"
+)
+
+var (
+	contentHeaders = []string{"ID", "TYPE", "SPACE", "VERSION", "TITLE"}
+)
+
+func contentRow(c confluence.Content) []string {
+	return []string{c.ID, c.Type, c.Space.Key, strconv.Itoa(c.Version.Number), c.Title}
+}
+
+// fetchContent 本文とバージョンを含めてコンテンツを取得する
+func fetchContent(client *confluence.Client, id string) (*confluence.Content, error) {
+	var ret confluence.Content
+	err := client.REST().DoDecode(
+		http.MethodGet,
+		rest.Pathf("/rest/api/content/%s", id),
+		url.Values{"expand": {"body.storage,version,space,ancestors"}},
+		nil,
+		&ret,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// readBody -bodyか-fileから本文を読む。-file -は標準入力
+func readBody(env *environment, body, file string) (string, bool, error) {
+	if body != "" {
+		return body, true, nil
+	}
+	if file == "" {
+		return "", false, nil
+	}
+	var r io.Reader = env.stdin
+	if file != "-" {
+		fh, err := os.Open(file)
+		if err != nil {
+			return "", false, err
+		}
+		defer fh.Close()
+		r = fh
+	}
+	bin, err := io.ReadAll(r)
+	if err != nil {
+		return "", false, err
+	}
+	return string(bin), true, nil
+}
+
+func printContent(env *environment, c *confluence.Content, withBody bool) error {
+	err := env.out.print(c, contentHeaders, [][]string{contentRow(*c)})
+	if err != nil {
+		return err
+	}
+	if withBody {
+		env.out.printText(c.Body.Storage.Value)
+	}
+	return nil
+}
+
+func pageGet(env *environment, args []string) error {
+	fs := newFlagSet("page get", env.stderr)
+	space := fs.String("space", "", "スペースキー")
+	title := fs.String("title", "", "タイトル")
+	withBody := fs.Bool("body", false, "本文も表示する")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	id := fs.Arg(0)
+	if id == "" {
+		if *space == "" || *title == "" {
+			return errUsage
+		}
+		resp, err := env.client.FetchContentByTitle(*space, *title)
+		if err != nil {
+			return err
+		}
+		var res confluence.ContentResults
+		err = rest.DecodeResponse(resp, &res)
+		if err != nil {
+			return err
+		}
+		if len(res.Results) == 0 {
+			return confluence.ErrNotFound
+		}
+		id = res.Results[0].ID
+	}
+	c, err := fetchContent(env.client, id)
+	if err != nil {
+		return err
+	}
+	return printContent(env, c, *withBody)
+}
+
+func pageCreate(env *environment, args []string) error {
+	fs := newFlagSet("page create", env.stderr)
+	space := fs.String("space", "", "スペースキー")
+	parent := fs.String("parent", "", "親ページのID")
+	title := fs.String("title", "", "タイトル")
+	body := fs.String("body", "", "本文(storage形式)")
+	file := fs.String("file", "", "本文のファイル。-の場合は標準入力")
+	blog := fs.Bool("blog", false, "ブログ投稿として作成する")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	content, ok, err := readBody(env, *body, *file)
+	if err != nil {
+		return err
+	}
+	if *space == "" || *title == "" || !ok {
+		return errUsage
+	}
+
+	pagetype := confluence.PageTypePage
+	if *blog {
+		pagetype = confluence.PageTypeBlog
+	}
+	resp, err := env.client.CreateContent(*space, *parent, *title, content, pagetype)
+	if err != nil {
+		return err
+	}
+	var created confluence.Content
+	err = rest.DecodeResponse(resp, &created)
+	if err != nil {
+		return err
+	}
+	return printContent(env, &created, false)
+}
+
+func pageUpdate(env *environment, args []string) error {
+	fs := newFlagSet("page update", env.stderr)
+	title := fs.String("title", "", "新しいタイトル。省略時は変えない")
+	body := fs.String("body", "", "本文(storage形式)")
+	file := fs.String("file", "", "本文のファイル。-の場合は標準入力")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	content, ok, err := readBody(env, *body, *file)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || !ok {
+		return errUsage
+	}
+
+	current, err := fetchContent(env.client, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	newTitle := current.Title
+	if *title != "" {
+		newTitle = *title
+	}
+	resp, err := env.client.UpdateContent(current.ID, float64(current.Version.Number), current.Type, newTitle, content)
+	if err != nil {
+		return err
+	}
+	var updated confluence.Content
+	err = rest.DecodeResponse(resp, &updated)
+	if err != nil {
+		return err
+	}
+	return printContent(env, &updated, false)
+}
+
+func pageMove(env *environment, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	resp, err := env.client.MovePage(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	var moved confluence.Content
+	err = rest.DecodeResponse(resp, &moved)
+	if err != nil {
+		return err
+	}
+	return printContent(env, &moved, false)
+}
+
+func pageDelete(env *environment, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	resp, err := env.client.DeleteContent(args[0])
+	if err != nil {
+		return err
+	}
+	err = rest.DecodeResponse(resp, nil)
+	if err != nil {
+		return err
+	}
+	return env.out.print(
+		map[string]interface{}{"id": args[0], "deleted": true},
+		[]string{"ID", "DELETED"},
+		[][]string{{args[0], "true"}},
+	)
+}
+
+func search(env *environment, args []string) error {
+	fs := newFlagSet("search", env.stderr)
+	start := fs.Int("start", 0, "開始位置")
+	limit := fs.Int("limit", 25, "件数")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+	res, err := env.client.Search(fs.Arg(0), *start, *limit)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, v := range res.Results {
+		rows = append(rows, []string{v.Content.ID, v.Content.Type, v.Content.Space.Key, v.LastModified, v.Title})
+	}
+	return env.out.print(res, []string{"ID", "TYPE", "SPACE", "LAST MODIFIED", "TITLE"}, rows)
+}
@@ -0,0 +1,299 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CircuitState サーキットブレーカーの状態
+type CircuitState int
+
+const (
+	// CircuitClosed 通常通りリクエストする
+	CircuitClosed CircuitState = iota
+	// CircuitOpen リクエストせずにErrCircuitOpenを返す
+	CircuitOpen
+	// CircuitHalfOpen クールダウンが終わって、試しにリクエストしている
+	CircuitHalfOpen
+)
+
+func (t CircuitState) String() string {
+	switch t {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+var (
+	// ErrCircuitOpen サーキットブレーカーが開いている時
+	// 返ってくるのは*CircuitOpenErrorなのでerrors.Isで判定する
+	ErrCircuitOpen = errors.New("サーキットブレーカーが開いています")
+
+	// DefaultCircuitBreakerConfig NewCircuitBreakerで足りない値に使う
+	DefaultCircuitBreakerConfig = CircuitBreakerConfig{
+		ConsecutiveFailures: 5,
+		MinRequests:         10,
+		Window:              time.Minute,
+		CoolDown:            30 * time.Second,
+		HalfOpenRequests:    1,
+	}
+)
+
+// CircuitOpenError サーキットブレーカーが開いていてリクエストしなかった時のエラー
+type CircuitOpenError struct {
+	Host string
+	// RetryAt 半開きになってリクエストできるようになる時刻
+	RetryAt time.Time
+}
+
+func (t *CircuitOpenError) Error() string {
+	return "circuit open: " + t.Host + ": retry at " + t.RetryAt.Format(time.RFC3339)
+}
+
+// Is ErrCircuitOpenと同じとみなす
+func (t *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitBreakerConfig サーキットブレーカーの設定
+type CircuitBreakerConfig struct {
+	// ConsecutiveFailures この回数続けて失敗したら開く。0の場合は使わない
+	ConsecutiveFailures int
+	// ErrorRate Windowの間の失敗の割合がこれ以上になったら開く。0の場合は使わない
+	ErrorRate float64
+	// MinRequests ErrorRateで判定するのに必要なWindowの間のリクエスト数
+	MinRequests int
+	// Window ErrorRateを数える期間
+	Window time.Duration
+	// CoolDown 開いてから半開きになるまでの時間
+	CoolDown time.Duration
+	// HalfOpenRequests 半開きの時に試すリクエストの数。すべて成功したら閉じる
+	HalfOpenRequests int
+	// IsFailure 失敗とみなすか。nilの場合は通信エラー、429、5xxを失敗とする
+	IsFailure func(resp *http.Response, err error) bool
+	// OnStateChange 状態が変わった時に呼ばれる
+	OnStateChange func(host string, from, to CircuitState)
+}
+
+// CircuitBreaker ホストごとのサーキットブレーカー
+// 複数のHTTPWaitClientで共有できる
+type CircuitBreaker struct {
+	config CircuitBreakerConfig
+	mutex  sync.Mutex
+	hosts  map[string]*circuit
+
+	// Now 現在時刻。テストで差し替える用
+	Now func() time.Time
+}
+
+// circuit ホストひとつ分の状態
+type circuit struct {
+	state       CircuitState
+	openedAt    time.Time
+	consecutive int
+
+	windowStart time.Time
+	requests    int
+	failures    int
+
+	// probes 半開きの時に許可したリクエストの数
+	probes    int
+	successes int
+}
+
+// NewCircuitBreaker CircuitBreakerを返す
+// ConsecutiveFailuresとErrorRateが両方0の場合はDefaultCircuitBreakerConfigのConsecutiveFailuresを使う
+func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
+	if config.ConsecutiveFailures <= 0 && config.ErrorRate <= 0 {
+		config.ConsecutiveFailures = DefaultCircuitBreakerConfig.ConsecutiveFailures
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = DefaultCircuitBreakerConfig.MinRequests
+	}
+	if config.Window <= 0 {
+		config.Window = DefaultCircuitBreakerConfig.Window
+	}
+	if config.CoolDown <= 0 {
+		config.CoolDown = DefaultCircuitBreakerConfig.CoolDown
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = DefaultCircuitBreakerConfig.HalfOpenRequests
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = defaultIsFailure
+	}
+	return &CircuitBreaker{
+		config: config,
+		hosts:  map[string]*circuit{},
+		Now:    time.Now,
+	}
+}
+
+// SetCircuitBreaker ホストごとのサーキットブレーカーを設定する。nilの場合は使わない
+// 開いている間はwaitTimerを待たずに*CircuitOpenErrorを返す
+func (t *HTTPWaitClient) SetCircuitBreaker(breaker *CircuitBreaker) {
+	t.updateSettings(func(settings *clientSettings) {
+		settings.breaker = breaker
+	})
+}
+
+// State hostの今の状態
+func (t *CircuitBreaker) State(host string) CircuitState {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	c, ok := t.hosts[host]
+	if !ok {
+		return CircuitClosed
+	}
+	if c.state == CircuitOpen && !t.Now().Before(c.openedAt.Add(t.config.CoolDown)) {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+// Reset hostの状態を閉じた状態に戻す
+func (t *CircuitBreaker) Reset(host string) {
+	t.mutex.Lock()
+	c, ok := t.hosts[host]
+	if !ok {
+		t.mutex.Unlock()
+		return
+	}
+	from := c.state
+	delete(t.hosts, host)
+	t.mutex.Unlock()
+	t.notify(host, from, CircuitClosed)
+}
+
+// allow hostにリクエストして良いか。良い場合は結果をdoneで返す
+func (t *CircuitBreaker) allow(host string) error {
+	t.mutex.Lock()
+	now := t.Now()
+	c := t.circuit(host, now)
+	from := c.state
+	var err error
+	switch c.state {
+	case CircuitOpen:
+		retryAt := c.openedAt.Add(t.config.CoolDown)
+		if now.Before(retryAt) {
+			err = &CircuitOpenError{Host: host, RetryAt: retryAt}
+			break
+		}
+		c.state = CircuitHalfOpen
+		c.probes = 1
+		c.successes = 0
+	case CircuitHalfOpen:
+		if c.probes >= t.config.HalfOpenRequests {
+			// 試しているリクエストの結果が出るまで待ってもらう
+			err = &CircuitOpenError{Host: host, RetryAt: now}
+			break
+		}
+		c.probes++
+	}
+	to := c.state
+	t.mutex.Unlock()
+	t.notify(host, from, to)
+	return err
+}
+
+// done allowで許可したリクエストの結果を記録する
+// 呼び出し元がキャンセルした場合など、成功とも失敗とも言えない場合はignoreにする
+func (t *CircuitBreaker) done(host string, resp *http.Response, err error) {
+	ignore := err != nil && errors.Is(err, context.Canceled)
+	t.record(host, ignore, !ignore && t.config.IsFailure(resp, err))
+}
+
+// cancel allowで許可したけどリクエストしなかった時に呼ぶ
+func (t *CircuitBreaker) cancel(host string) {
+	t.record(host, true, false)
+}
+
+func (t *CircuitBreaker) record(host string, ignore, failure bool) {
+	t.mutex.Lock()
+	now := t.Now()
+	c := t.circuit(host, now)
+	from := c.state
+	switch c.state {
+	case CircuitHalfOpen:
+		switch {
+		case ignore:
+			if c.probes > 0 {
+				c.probes--
+			}
+		case failure:
+			t.open(c, now)
+		default:
+			c.successes++
+			if c.successes >= t.config.HalfOpenRequests {
+				*c = circuit{state: CircuitClosed, windowStart: now}
+			}
+		}
+	case CircuitClosed:
+		if ignore {
+			break
+		}
+		c.requests++
+		if !failure {
+			c.consecutive = 0
+			break
+		}
+		c.failures++
+		c.consecutive++
+		if t.shouldOpen(c) {
+			t.open(c, now)
+		}
+	}
+	to := c.state
+	t.mutex.Unlock()
+	t.notify(host, from, to)
+}
+
+func (t *CircuitBreaker) circuit(host string, now time.Time) *circuit {
+	c, ok := t.hosts[host]
+	if !ok {
+		c = &circuit{state: CircuitClosed, windowStart: now}
+		t.hosts[host] = c
+	}
+	if c.state == CircuitClosed && !now.Before(c.windowStart.Add(t.config.Window)) {
+		c.windowStart = now
+		c.requests = 0
+		c.failures = 0
+	}
+	return c
+}
+
+func (t *CircuitBreaker) shouldOpen(c *circuit) bool {
+	if t.config.ConsecutiveFailures > 0 && c.consecutive >= t.config.ConsecutiveFailures {
+		return true
+	}
+	if t.config.ErrorRate > 0 && c.requests >= t.config.MinRequests {
+		return float64(c.failures)/float64(c.requests) >= t.config.ErrorRate
+	}
+	return false
+}
+
+func (t *CircuitBreaker) open(c *circuit, now time.Time) {
+	*c = circuit{state: CircuitOpen, openedAt: now}
+}
+
+func (t *CircuitBreaker) notify(host string, from, to CircuitState) {
+	if from == to || t.config.OnStateChange == nil {
+		return
+	}
+	t.config.OnStateChange(host, from, to)
+}
+
+func defaultIsFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
@@ -0,0 +1,348 @@
+package network
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheEntry キャッシュしたレスポンス
+type CacheEntry struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	StoredAt   time.Time
+}
+
+// CacheBackend キャッシュの保存先
+type CacheBackend interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, entry *CacheEntry)
+	Delete(key string)
+}
+
+// MemoryCache メモリ上のLRUキャッシュ
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// NewMemoryCache maxEntries件までのLRUキャッシュを返す
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+// Get キャッシュを取得する
+func (t *MemoryCache) Get(key string) (*CacheEntry, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	elem, ok := t.entries[key]
+	if !ok {
+		return nil, false
+	}
+	t.lru.MoveToFront(elem)
+	return elem.Value.(*memoryCacheItem).entry, true
+}
+
+// Set キャッシュに入れる。maxEntriesを超えたら古いものから消す
+func (t *MemoryCache) Set(key string, entry *CacheEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if elem, ok := t.entries[key]; ok {
+		elem.Value.(*memoryCacheItem).entry = entry
+		t.lru.MoveToFront(elem)
+		return
+	}
+	t.entries[key] = t.lru.PushFront(&memoryCacheItem{key: key, entry: entry})
+	for t.maxEntries > 0 && t.lru.Len() > t.maxEntries {
+		oldest := t.lru.Back()
+		t.lru.Remove(oldest)
+		delete(t.entries, oldest.Value.(*memoryCacheItem).key)
+	}
+}
+
+// Delete キャッシュを消す
+func (t *MemoryCache) Delete(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if elem, ok := t.entries[key]; ok {
+		t.lru.Remove(elem)
+		delete(t.entries, key)
+	}
+}
+
+// DiskCache ディレクトリにjsonで保存するキャッシュ
+type DiskCache struct {
+	mu        sync.Mutex
+	directory string
+}
+
+// NewDiskCache directoryに保存するキャッシュを返す
+func NewDiskCache(directory string) (*DiskCache, error) {
+	err := os.MkdirAll(directory, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	return &DiskCache{directory: directory}, nil
+}
+
+func (t *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(t.directory, hex.EncodeToString(sum[:])+".json")
+}
+
+// Get キャッシュを取得する
+func (t *DiskCache) Get(key string) (*CacheEntry, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	bin, err := ioutil.ReadFile(t.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry CacheEntry
+	err = json.Unmarshal(bin, &entry)
+	if err != nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// Set キャッシュに入れる。書き込めなかった場合は何もしない
+func (t *DiskCache) Set(key string, entry *CacheEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	bin, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	path := t.path(key)
+	tmp := path + ".tmp"
+	if ioutil.WriteFile(tmp, bin, 0644) != nil {
+		os.Remove(tmp)
+		return
+	}
+	os.Rename(tmp, path)
+}
+
+// Delete キャッシュを消す
+func (t *DiskCache) Delete(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	os.Remove(t.path(key))
+}
+
+var (
+	// DefaultCacheMaxEntrySize NewHTTPCacheで設定するキャッシュするレスポンスの最大サイズ
+	DefaultCacheMaxEntrySize int64 = 1 << 20
+)
+
+type cacheRule struct {
+	pattern *regexp.Regexp
+	ttl     time.Duration
+}
+
+// HTTPCache GETのレスポンスをキャッシュする
+// TTLの間はサーバーに問い合わせず、過ぎたらIf-None-Match/If-Modified-Sinceで再検証する
+type HTTPCache struct {
+	mu           sync.RWMutex
+	backend      CacheBackend
+	defaultTTL   time.Duration
+	rules        []cacheRule
+	maxEntrySize int64
+}
+
+// NewHTTPCache キャッシュを作る
+// defaultTTLが0の場合は毎回再検証する。負の場合はキャッシュしない
+func NewHTTPCache(backend CacheBackend, defaultTTL time.Duration) *HTTPCache {
+	return &HTTPCache{
+		backend:      backend,
+		defaultTTL:   defaultTTL,
+		maxEntrySize: DefaultCacheMaxEntrySize,
+	}
+}
+
+// SetMaxEntrySize これより大きいレスポンスはキャッシュしない。0以下の場合は制限しない
+// 大きいレスポンスはメモリに読み込まず、そのまま返す
+func (t *HTTPCache) SetMaxEntrySize(size int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.maxEntrySize = size
+}
+
+func (t *HTTPCache) entrySizeLimit() int64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.maxEntrySize
+}
+
+// SetTTL urlPatternの正規表現に一致するURLのTTLを設定する
+// 先に設定したものが優先される
+func (t *HTTPCache) SetTTL(urlPattern string, ttl time.Duration) error {
+	re, err := regexp.Compile(urlPattern)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rules = append(t.rules, cacheRule{pattern: re, ttl: ttl})
+	return nil
+}
+
+func (t *HTTPCache) ttl(url string) time.Duration {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, r := range t.rules {
+		if r.pattern.MatchString(url) {
+			return r.ttl
+		}
+	}
+	return t.defaultTTL
+}
+
+// cacheKey 認証ごとに分ける。認証情報そのものは保存しない
+func cacheKey(req *http.Request) string {
+	key := req.Method + " " + req.URL.String()
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		sum := sha256.Sum256([]byte(auth))
+		key += " " + hex.EncodeToString(sum[:8])
+	}
+	return key
+}
+
+func cacheable(req *http.Request) bool {
+	return req.Method == http.MethodGet && req.Header.Get("Range") == ""
+}
+
+// cacheableContent APIのレスポンスだけキャッシュする
+// 添付ファイルのダウンロードはWriteDownloadのサイズやディスクの確認を通したいのでキャッシュしない
+func cacheableContent(resp *http.Response) bool {
+	if strings.HasPrefix(resp.Header.Get("Content-Disposition"), "attachment") {
+		return false
+	}
+	contentType := strings.ToLower(resp.Header.Get(ContentType))
+	return strings.Contains(contentType, "json") ||
+		strings.Contains(contentType, "xml") ||
+		strings.HasPrefix(contentType, "text/")
+}
+
+// lookup 新しいキャッシュがあればレスポンスを返す
+// 古いキャッシュしかない場合は再検証用のヘッダをreqに付けてentryを返す
+func (t *HTTPCache) lookup(req *http.Request) (*http.Response, *CacheEntry) {
+	if !cacheable(req) || t.ttl(req.URL.String()) < 0 {
+		return nil, nil
+	}
+	entry, ok := t.backend.Get(cacheKey(req))
+	if !ok {
+		return nil, nil
+	}
+	if time.Since(entry.StoredAt) < t.ttl(req.URL.String()) {
+		return entry.response(req), nil
+	}
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+	return nil, entry
+}
+
+// store レスポンスをキャッシュする。304の時はentryを使ったレスポンスを返す
+func (t *HTTPCache) store(req *http.Request, resp *http.Response, entry *CacheEntry) (*http.Response, error) {
+	if !cacheable(req) || t.ttl(req.URL.String()) < 0 {
+		return resp, nil
+	}
+	key := cacheKey(req)
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		resp.Body.Close()
+		refreshed := *entry
+		refreshed.StoredAt = time.Now()
+		t.backend.Set(key, &refreshed)
+		return refreshed.response(req), nil
+	}
+	if resp.StatusCode != http.StatusOK || strings.Contains(resp.Header.Get("Cache-Control"), "no-store") {
+		return resp, nil
+	}
+	if resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == "" && t.ttl(req.URL.String()) == 0 {
+		// 再検証もできないので意味がない
+		return resp, nil
+	}
+
+	maxSize := t.entrySizeLimit()
+	if !cacheableContent(resp) || (maxSize > 0 && resp.ContentLength > maxSize) {
+		t.backend.Delete(key)
+		return resp, nil
+	}
+
+	reader := io.Reader(resp.Body)
+	if maxSize > 0 {
+		reader = io.LimitReader(resp.Body, maxSize+1)
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if maxSize > 0 && int64(len(body)) > maxSize {
+		// Content-Lengthが無くて大きかった。読んだ分を戻してキャッシュせずに返す
+		resp.Body = &prefixedBody{
+			Reader: io.MultiReader(bytes.NewReader(body), resp.Body),
+			Closer: resp.Body,
+		}
+		t.backend.Delete(key)
+		return resp, nil
+	}
+	resp.Body.Close()
+	t.backend.Set(key, &CacheEntry{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+		StoredAt:   time.Now(),
+	})
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// prefixedBody 先に読んでしまった分を戻したbody
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
+
+func (t *CacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        strconv.Itoa(t.StatusCode) + " " + http.StatusText(t.StatusCode),
+		StatusCode:    t.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        t.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(t.Body)),
+		ContentLength: int64(len(t.Body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd || dragonfly
+
+package network
+
+import "syscall"
+
+// diskFree directoryのあるディスクの空き容量を返す
+func diskFree(directory string) (int64, bool) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(directory, &stat); err != nil {
+		return 0, false
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), true
+}
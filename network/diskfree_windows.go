@@ -0,0 +1,31 @@
+//go:build windows
+
+package network
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procGetDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+)
+
+// diskFree directoryのあるディスクの空き容量を返す
+func diskFree(directory string) (int64, bool) {
+	path, err := syscall.UTF16PtrFromString(directory)
+	if err != nil {
+		return 0, false
+	}
+	var freeBytesAvailable uint64
+	r1, _, _ := procGetDiskFreeSpaceEx.Call(
+		uintptr(unsafe.Pointer(path)),
+		uintptr(unsafe.Pointer(&freeBytesAvailable)),
+		0,
+		0,
+	)
+	if r1 == 0 {
+		return 0, false
+	}
+	return int64(freeBytesAvailable), true
+}
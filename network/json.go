@@ -0,0 +1,189 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	// DefaultMaxJSONSize DecodeJSONで読むbodyの上限。0以下の場合は制限しない
+	DefaultMaxJSONSize int64 = 10 << 20
+
+	// JSONErrorSnippetSize エラーに含めるbodyの先頭のバイト数
+	JSONErrorSnippetSize = 512
+
+	// ErrUnexpectedStatus 2xx以外のステータスの時
+	ErrUnexpectedStatus = errors.New("想定外のステータスです")
+
+	// ErrUnexpectedContentType jsonではないContent-Typeの時
+	ErrUnexpectedContentType = errors.New("想定外のContent-Typeです")
+
+	// ErrBodyTooLarge bodyが上限を超えた時
+	ErrBodyTooLarge = errors.New("bodyが上限を超えました")
+)
+
+// JSONError jsonのレスポンスを読めなかった時のエラー
+// ログインページのhtmlが返ってくることがあるので、bodyの先頭をSnippetに入れる
+type JSONError struct {
+	StatusCode  int
+	ContentType string
+	Snippet     string
+	Err         error
+}
+
+func (t *JSONError) Error() string {
+	return "network: " + t.Err.Error() +
+		" (status " + strconv.Itoa(t.StatusCode) + ", " + t.ContentType + "): " + t.Snippet
+}
+
+// Unwrap Errを返す
+func (t *JSONError) Unwrap() error {
+	return t.Err
+}
+
+// DecodeJSON respのbodyをTにデコードする
+// 2xx以外やjson以外のContent-Typeの場合は*JSONErrorを返す。bodyは必ず閉じる
+func DecodeJSON[T any](resp *http.Response) (*T, error) {
+	return DecodeJSONWithLimit[T](resp, DefaultMaxJSONSize)
+}
+
+// DecodeJSONWithLimit maxSizeバイトまでのbodyをTにデコードする
+// maxSizeが0以下の場合は制限しない
+func DecodeJSONWithLimit[T any](resp *http.Response, maxSize int64) (*T, error) {
+	defer resp.Body.Close()
+
+	snippet := &snippetWriter{max: JSONErrorSnippetSize}
+	reader := io.Reader(resp.Body)
+	if maxSize > 0 {
+		reader = newLimitedReader(resp.Body, maxSize, SizeLimitResponse)
+	}
+	body := io.TeeReader(reader, snippet)
+	newError := func(err error) error {
+		// エラーの時はsnippetが埋まるまで読んでおく
+		io.CopyN(io.Discard, body, int64(JSONErrorSnippetSize))
+		return &JSONError{
+			StatusCode:  resp.StatusCode,
+			ContentType: resp.Header.Get(ContentType),
+			Snippet:     snippet.String(),
+			Err:         err,
+		}
+	}
+
+	if resp.StatusCode < 200 || 300 <= resp.StatusCode {
+		return nil, newError(ErrUnexpectedStatus)
+	}
+	if !isJSONContentType(resp.Header.Get(ContentType)) {
+		return nil, newError(ErrUnexpectedContentType)
+	}
+
+	var ret T
+	err := json.NewDecoder(body).Decode(&ret)
+	if err != nil {
+		return nil, newError(err)
+	}
+	return &ret, nil
+}
+
+// DoJSON reqBodyをjsonにしてリクエストし、レスポンスをTにデコードする
+// reqBodyがnilの場合はbodyを送らない
+func DoJSON[T any](
+	client *HTTPWaitClient,
+	method,
+	url string,
+	reqBody interface{},
+	header map[string]string,
+) (*T, error) {
+	h := map[string]string{
+		"Accept": ApplicationJSON,
+	}
+	var body io.Reader
+	if reqBody != nil {
+		bin, err := json.Marshal(reqBody)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(bin)
+		h[ContentType] = ApplicationJSON
+	}
+	for k, v := range header {
+		h[k] = v
+	}
+	resp, err := client.DoRequest(method, url, body, h)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeJSON[T](resp)
+}
+
+func isJSONContentType(contentType string) bool {
+	if contentType == "" {
+		// 付けてこないサーバーもあるので許す
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == ApplicationJSON || strings.HasSuffix(mediaType, "+json")
+}
+
+// limitedReader limitを超えて読もうとすると*SizeLimitErrorを返す
+type limitedReader struct {
+	r         io.Reader
+	kind      SizeLimitKind
+	limit     int64
+	remaining int64
+}
+
+func newLimitedReader(r io.Reader, limit int64, kind SizeLimitKind) *limitedReader {
+	return &limitedReader{
+		r:         r,
+		kind:      kind,
+		limit:     limit,
+		remaining: limit,
+	}
+}
+
+func (t *limitedReader) Read(p []byte) (int, error) {
+	if t.remaining < 0 {
+		return 0, &SizeLimitError{Kind: t.kind, Limit: t.limit, Size: -1}
+	}
+	// limitを超えたことがわかるように1バイト多く読む
+	// remaining+1はlimitがmath.MaxInt64の時にあふれるので、len(p)-1と比べる
+	if t.remaining < int64(len(p))-1 {
+		p = p[:t.remaining+1]
+	}
+	n, err := t.r.Read(p)
+	t.remaining -= int64(n)
+	if t.remaining < 0 {
+		return n - int(-t.remaining), &SizeLimitError{Kind: t.kind, Limit: t.limit, Size: -1}
+	}
+	return n, err
+}
+
+// snippetWriter 先頭maxバイトだけ覚えておく
+type snippetWriter struct {
+	buf bytes.Buffer
+	max int
+}
+
+func (t *snippetWriter) Write(p []byte) (int, error) {
+	if rest := t.max - t.buf.Len(); rest > 0 {
+		if len(p) > rest {
+			t.buf.Write(p[:rest])
+		} else {
+			t.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (t *snippetWriter) String() string {
+	return strings.ToValidUTF8(t.buf.String(), "")
+}
@@ -0,0 +1,158 @@
+package network
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// SizeLimitKind どの上限を超えたか
+type SizeLimitKind string
+
+var (
+	// SizeLimitResponse レスポンスの上限
+	SizeLimitResponse SizeLimitKind = "response"
+
+	// SizeLimitDownload ダウンロードの上限
+	SizeLimitDownload SizeLimitKind = "download"
+
+	// SizeLimitDisk ディスクの空き容量
+	SizeLimitDisk SizeLimitKind = "disk"
+
+	// diskCheckInterval サイズがわからないダウンロードで空き容量を確認する間隔
+	diskCheckInterval int64 = 8 << 20
+)
+
+// SizeLimitError サイズの上限を超えた時のエラー
+// errors.Is(err, ErrBodyTooLarge)でも判定できる
+type SizeLimitError struct {
+	Kind SizeLimitKind
+	// Limit 上限。ディスクの場合は使える容量
+	Limit int64
+	// Size わかっている場合のサイズ。わからない場合は-1
+	Size int64
+}
+
+func (t *SizeLimitError) Error() string {
+	ret := string(t.Kind) + " size limit exceeded: limit " + strconv.FormatInt(t.Limit, 10)
+	if t.Size >= 0 {
+		ret += ", size " + strconv.FormatInt(t.Size, 10)
+	}
+	return ret
+}
+
+// Is ErrBodyTooLargeと同じとみなす
+func (t *SizeLimitError) Is(target error) bool {
+	return target == ErrBodyTooLarge
+}
+
+// SetMaxResponseSize DoRequestで返すレスポンスのbodyの上限を設定する
+// 超えた場合はbodyのReadが*SizeLimitErrorを返す。0の場合は無制限
+func (t *HTTPWaitClient) SetMaxResponseSize(size int64) {
+	t.updateSettings(func(settings *clientSettings) {
+		settings.maxResponseSize = size
+	})
+}
+
+// SetMaxDownloadSize WriteDownloadで書き込むサイズの上限を設定する。0の場合は無制限
+func (t *HTTPWaitClient) SetMaxDownloadSize(size int64) {
+	t.updateSettings(func(settings *clientSettings) {
+		settings.maxDownloadSize = size
+	})
+}
+
+// SetMinFreeDiskSpace WriteDownloadの後にディスクに残しておく空き容量を設定する
+func (t *HTTPWaitClient) SetMinFreeDiskSpace(size int64) {
+	t.updateSettings(func(settings *clientSettings) {
+		settings.minFreeDiskSpace = size
+	})
+}
+
+// limitResponse respのbodyをmaxResponseSizeで制限する
+// WriteDownloadでは制限を外せるように、Content-Lengthが大きくてもここでは断らずReadで断る
+func (t *clientSettings) limitResponse(resp *http.Response) (*http.Response, error) {
+	if t.maxResponseSize <= 0 {
+		return resp, nil
+	}
+	resp.Body = &limitedBody{
+		ReadCloser: resp.Body,
+		reader:     newLimitedReader(resp.Body, t.maxResponseSize, SizeLimitResponse),
+	}
+	return resp, nil
+}
+
+// WriteDownload respのbodyをwに書き込む
+// SetMaxDownloadSizeの上限を超える場合や、directoryの空き容量が足りなくなる場合は*SizeLimitErrorを返す
+// directoryが空の場合は空き容量を確認しない。SetMaxResponseSizeの上限は使わない
+func (t *HTTPWaitClient) WriteDownload(w io.Writer, resp *http.Response, directory string) (int64, error) {
+	settings := t.currentSettings()
+	body := io.Reader(resp.Body)
+	if lb, ok := resp.Body.(*limitedBody); ok {
+		body = lb.ReadCloser
+	}
+
+	if settings.maxDownloadSize > 0 {
+		if resp.ContentLength > settings.maxDownloadSize {
+			return 0, &SizeLimitError{Kind: SizeLimitDownload, Limit: settings.maxDownloadSize, Size: resp.ContentLength}
+		}
+		body = newLimitedReader(body, settings.maxDownloadSize, SizeLimitDownload)
+	}
+	if directory != "" {
+		err := checkDiskSpace(directory, settings.minFreeDiskSpace, resp.ContentLength)
+		if err != nil {
+			return 0, err
+		}
+		if resp.ContentLength < 0 {
+			w = &diskCheckWriter{w: w, directory: directory, minFree: settings.minFreeDiskSpace}
+		}
+	}
+	return io.Copy(w, body)
+}
+
+func checkDiskSpace(directory string, minFree, size int64) error {
+	free, ok := diskFree(directory)
+	if !ok {
+		return nil
+	}
+	available := free - minFree
+	if available < 0 {
+		available = 0
+	}
+	if size < 0 {
+		size = 0
+	}
+	if available < size || available <= 0 {
+		return &SizeLimitError{Kind: SizeLimitDisk, Limit: available, Size: size}
+	}
+	return nil
+}
+
+// limitedBody bodyを閉じるのは元のReadCloser
+type limitedBody struct {
+	io.ReadCloser
+	reader io.Reader
+}
+
+func (t *limitedBody) Read(p []byte) (int, error) {
+	return t.reader.Read(p)
+}
+
+// diskCheckWriter サイズのわからないダウンロードで時々空き容量を確認する
+type diskCheckWriter struct {
+	w         io.Writer
+	directory string
+	minFree   int64
+	written   int64
+}
+
+func (t *diskCheckWriter) Write(p []byte) (int, error) {
+	before := t.written / diskCheckInterval
+	t.written += int64(len(p))
+	if t.written/diskCheckInterval != before {
+		err := checkDiskSpace(t.directory, t.minFree, int64(len(p)))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return t.w.Write(p)
+}
@@ -0,0 +1,325 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultLatencyBuckets MemoryMetricsのレイテンシのヒストグラムの区切り(秒)
+	DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+	// StatusClassError レスポンスが返ってこなかった時のステータスクラス
+	StatusClassError = "error"
+)
+
+// MetricLabels メトリクスのラベル
+type MetricLabels struct {
+	Host   string
+	Method string
+	// StatusClass "2xx"のようなステータスのクラス。レスポンスがない時はStatusClassError
+	// レートリミットの待ち時間ではリクエスト前なので空
+	StatusClass string
+}
+
+// Metrics HTTPWaitClientのメトリクスの記録先
+// 複数のgoroutineから呼ばれる
+type Metrics interface {
+	// ObserveRequest リクエストからレスポンスヘッダが返ってくるまでの時間
+	ObserveRequest(labels MetricLabels, latency time.Duration)
+	// AddBytesSent 送ったbodyのバイト数
+	AddBytesSent(labels MetricLabels, n int64)
+	// AddBytesReceived 読んだbodyのバイト数。bodyを読むたびに呼ばれる
+	AddBytesReceived(labels MetricLabels, n int64)
+	// IncRetries リトライしたリクエストの数
+	IncRetries(labels MetricLabels)
+	// ObserveRateLimitWait WaitTimerなどでブロックされた時間
+	ObserveRateLimitWait(labels MetricLabels, wait time.Duration)
+}
+
+// SetMetrics メトリクスの記録先を設定する。nilの場合は記録しない
+func (t *HTTPWaitClient) SetMetrics(metrics Metrics) {
+	t.updateSettings(func(settings *clientSettings) {
+		settings.metrics = metrics
+	})
+}
+
+type retryAttemptKey struct{}
+
+// WithRetryAttempt 何回目のリトライかをctxに入れる
+// DoRequestContextに渡すと、1以上の場合はリトライとして記録される
+func WithRetryAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, retryAttemptKey{}, attempt)
+}
+
+func retryAttempt(ctx context.Context) int {
+	v, _ := ctx.Value(retryAttemptKey{}).(int)
+	return v
+}
+
+// StatusClass ステータスコードを"2xx"のようなクラスにする
+func StatusClass(statusCode int) string {
+	if statusCode < 100 || 999 < statusCode {
+		return StatusClassError
+	}
+	return strconv.Itoa(statusCode/100) + "xx"
+}
+
+// MetricValues ラベルごとの値
+type MetricValues struct {
+	Requests      int64
+	LatencySum    time.Duration
+	LatencyMax    time.Duration
+	BytesSent     int64
+	BytesReceived int64
+	Retries       int64
+	// RateLimitWait ブロックされた時間の合計
+	RateLimitWait time.Duration
+	// RateLimitWaits ブロックされた回数
+	RateLimitWaits int64
+	// LatencyBuckets MemoryMetricsのbucketsそれぞれ以下だったリクエストの数(累積)
+	LatencyBuckets []int64
+}
+
+// MemoryMetrics メモリ上にメトリクスを持つ
+type MemoryMetrics struct {
+	mutex   sync.Mutex
+	buckets []float64
+	values  map[MetricLabels]*MetricValues
+}
+
+// NewMemoryMetrics MemoryMetricsを返す。bucketsがnilの場合はDefaultLatencyBuckets
+func NewMemoryMetrics(buckets []float64) *MemoryMetrics {
+	if buckets == nil {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &MemoryMetrics{
+		buckets: buckets,
+		values:  map[MetricLabels]*MetricValues{},
+	}
+}
+
+func (t *MemoryMetrics) get(labels MetricLabels) *MetricValues {
+	v, ok := t.values[labels]
+	if !ok {
+		v = &MetricValues{LatencyBuckets: make([]int64, len(t.buckets))}
+		t.values[labels] = v
+	}
+	return v
+}
+
+// ObserveRequest Metricsの実装
+func (t *MemoryMetrics) ObserveRequest(labels MetricLabels, latency time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	v := t.get(labels)
+	v.Requests++
+	v.LatencySum += latency
+	if latency > v.LatencyMax {
+		v.LatencyMax = latency
+	}
+	for i, b := range t.buckets {
+		if latency.Seconds() <= b {
+			v.LatencyBuckets[i]++
+		}
+	}
+}
+
+// AddBytesSent Metricsの実装
+func (t *MemoryMetrics) AddBytesSent(labels MetricLabels, n int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.get(labels).BytesSent += n
+}
+
+// AddBytesReceived Metricsの実装
+func (t *MemoryMetrics) AddBytesReceived(labels MetricLabels, n int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.get(labels).BytesReceived += n
+}
+
+// IncRetries Metricsの実装
+func (t *MemoryMetrics) IncRetries(labels MetricLabels) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.get(labels).Retries++
+}
+
+// ObserveRateLimitWait Metricsの実装
+func (t *MemoryMetrics) ObserveRateLimitWait(labels MetricLabels, wait time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	v := t.get(labels)
+	v.RateLimitWait += wait
+	v.RateLimitWaits++
+}
+
+// Buckets レイテンシのヒストグラムの区切り(秒)
+func (t *MemoryMetrics) Buckets() []float64 {
+	return append([]float64(nil), t.buckets...)
+}
+
+// Snapshot 今の値のコピーを返す
+func (t *MemoryMetrics) Snapshot() map[MetricLabels]MetricValues {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	ret := make(map[MetricLabels]MetricValues, len(t.values))
+	for k, v := range t.values {
+		copied := *v
+		copied.LatencyBuckets = append([]int64(nil), v.LatencyBuckets...)
+		ret[k] = copied
+	}
+	return ret
+}
+
+// Reset 値をすべて消す
+func (t *MemoryMetrics) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.values = map[MetricLabels]*MetricValues{}
+}
+
+// PrometheusMetrics Prometheusのテキスト形式で出力できるMetrics
+// http.Handlerなので/metricsなどにそのまま登録できる
+type PrometheusMetrics struct {
+	*MemoryMetrics
+	// Namespace メトリクス名の先頭につける。空の場合は"gogutil"
+	Namespace string
+}
+
+// NewPrometheusMetrics PrometheusMetricsを返す。bucketsがnilの場合はDefaultLatencyBuckets
+func NewPrometheusMetrics(namespace string, buckets []float64) *PrometheusMetrics {
+	return &PrometheusMetrics{
+		MemoryMetrics: NewMemoryMetrics(buckets),
+		Namespace:     namespace,
+	}
+}
+
+// WriteTo Prometheusのテキスト形式でwに書き込む
+func (t *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	ns := t.Namespace
+	if ns == "" {
+		ns = "gogutil"
+	}
+	prefix := ns + "_http_client_"
+	snapshot := t.Snapshot()
+	keys := make([]MetricLabels, 0, len(snapshot))
+	for k := range snapshot {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+
+	b := &strings.Builder{}
+	counter := func(name, help string, value func(MetricValues) string, skip func(MetricValues) bool) {
+		fmt.Fprintf(b, "# HELP %s%s %s\n# TYPE %s%s counter\n", prefix, name, help, prefix, name)
+		for _, k := range keys {
+			if skip(snapshot[k]) {
+				continue
+			}
+			fmt.Fprintf(b, "%s%s{%s} %s\n", prefix, name, k.String(), value(snapshot[k]))
+		}
+	}
+	noRequests := func(v MetricValues) bool { return v.Requests == 0 && v.Retries == 0 }
+
+	counter("requests_total", "Number of HTTP requests.",
+		func(v MetricValues) string { return strconv.FormatInt(v.Requests, 10) },
+		func(v MetricValues) bool { return v.Requests == 0 })
+	counter("retries_total", "Number of retried HTTP requests.",
+		func(v MetricValues) string { return strconv.FormatInt(v.Retries, 10) }, noRequests)
+	counter("sent_bytes_total", "Request body bytes sent.",
+		func(v MetricValues) string { return strconv.FormatInt(v.BytesSent, 10) },
+		func(v MetricValues) bool { return v.Requests == 0 })
+	counter("received_bytes_total", "Response body bytes received.",
+		func(v MetricValues) string { return strconv.FormatInt(v.BytesReceived, 10) },
+		func(v MetricValues) bool { return v.Requests == 0 })
+	counter("rate_limit_wait_seconds_total", "Time spent blocked by the rate limiter.",
+		func(v MetricValues) string { return formatFloat(v.RateLimitWait.Seconds()) },
+		func(v MetricValues) bool { return v.RateLimitWaits == 0 })
+	counter("rate_limit_waits_total", "Number of requests that went through the rate limiter.",
+		func(v MetricValues) string { return strconv.FormatInt(v.RateLimitWaits, 10) },
+		func(v MetricValues) bool { return v.RateLimitWaits == 0 })
+
+	name := prefix + "request_duration_seconds"
+	fmt.Fprintf(b, "# HELP %s Time until the response headers arrived.\n# TYPE %s histogram\n", name, name)
+	for _, k := range keys {
+		v := snapshot[k]
+		if v.Requests == 0 {
+			continue
+		}
+		labels := k.String()
+		for i, le := range t.buckets {
+			fmt.Fprintf(b, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(le), v.LatencyBuckets[i])
+		}
+		fmt.Fprintf(b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, v.Requests)
+		fmt.Fprintf(b, "%s_sum{%s} %s\n", name, labels, formatFloat(v.LatencySum.Seconds()))
+		fmt.Fprintf(b, "%s_count{%s} %d\n", name, labels, v.Requests)
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP WriteToの内容を返す
+func (t *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(ContentType, "text/plain; version=0.0.4; charset=utf-8")
+	t.WriteTo(w)
+}
+
+// String Prometheusのラベルの形式
+func (t MetricLabels) String() string {
+	return "host=" + strconv.Quote(t.Host) +
+		",method=" + strconv.Quote(t.Method) +
+		",status_class=" + strconv.Quote(t.StatusClass)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countingBody 読んだバイト数をMetricsに記録する
+type countingBody struct {
+	io.ReadCloser
+	metrics Metrics
+	labels  MetricLabels
+}
+
+func (t *countingBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.metrics.AddBytesReceived(t.labels, int64(n))
+	}
+	return n, err
+}
+
+// countingReader 送ったbodyのバイト数を数える
+type countingReader struct {
+	io.ReadCloser
+	mutex sync.Mutex
+	n     int64
+}
+
+func (t *countingReader) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	t.mutex.Lock()
+	t.n += int64(n)
+	t.mutex.Unlock()
+	return n, err
+}
+
+func (t *countingReader) count() int64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.n
+}
@@ -0,0 +1,197 @@
+package network
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/naminomare/gogutil/timer"
+)
+
+var (
+	// RequestIDHeader RequestIDMiddlewareで付けるヘッダ
+	RequestIDHeader = "X-Request-ID"
+
+	// RedactedHeaders ログに出さないヘッダ
+	RedactedHeaders = []string{
+		"Authorization",
+		"Proxy-Authorization",
+		"Cookie",
+		"Set-Cookie",
+	}
+
+	// RedactedQueryParams ログに出さないクエリパラメータ
+	RedactedQueryParams = []string{
+		"os_password",
+		"password",
+		"token",
+		"access_token",
+		"api_key",
+	}
+
+	redacted = "REDACTED"
+)
+
+// Middleware http.RoundTripperを包んで、リクエストの前後に処理を挟む
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc 関数をhttp.RoundTripperとして使う
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip fを呼ぶ
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Use middlewareを追加する
+// 先に追加したものほど外側で実行される。キャッシュが新しい時は通らない
+func (t *HTTPWaitClient) Use(middlewares ...Middleware) {
+	t.updateSettings(func(settings *clientSettings) {
+		// DoRequestが持っているコピーと配列を共有しないように作り直す
+		settings.middlewares = append(append([]Middleware(nil), settings.middlewares...), middlewares...)
+	})
+}
+
+func chainMiddlewares(transport http.RoundTripper, middlewares []Middleware) http.RoundTripper {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		transport = middlewares[i](transport)
+	}
+	return transport
+}
+
+// UserAgentMiddleware User-Agentを付ける。既に付いている場合は何もしない
+func UserAgentMiddleware(userAgent string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("User-Agent") == "" {
+				req = req.Clone(req.Context())
+				req.Header.Set("User-Agent", userAgent)
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+type requestIDKey struct{}
+
+// RequestIDMiddleware RequestIDHeaderにリクエストIDを付ける
+// 既に付いている場合はそれを使う。generatorがnilの場合はランダムなIDを作る
+func RequestIDMiddleware(generator func() string) Middleware {
+	if generator == nil {
+		generator = newRequestID
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			id := req.Header.Get(RequestIDHeader)
+			if id == "" {
+				id = generator()
+			}
+			req = req.Clone(context.WithValue(req.Context(), requestIDKey{}, id))
+			req.Header.Set(RequestIDHeader, id)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// RequestID RequestIDMiddlewareで付けたIDを返す
+func RequestID(req *http.Request) string {
+	if id, ok := req.Context().Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	return req.Header.Get(RequestIDHeader)
+}
+
+func newRequestID() string {
+	bin := make([]byte, 16)
+	rand.Read(bin)
+	return hex.EncodeToString(bin)
+}
+
+// DurationMiddleware リクエストにかかった時間をfnに渡す
+// errがnilでない時はrespはnil
+func DurationMiddleware(fn func(req *http.Request, resp *http.Response, err error, duration time.Duration)) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			sw := timer.NewStopWatch()
+			sw.Start()
+			resp, err := next.RoundTrip(req)
+			fn(req, resp, err, sw.Stop())
+			return resp, err
+		})
+	}
+}
+
+// LoggingMiddleware log/slogでリクエストを記録する
+// 認証情報はRedactedHeaders, RedactedQueryParamsに従って伏せる
+// ヘッダはDebugレベルの時だけ出す
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return DurationMiddleware(func(req *http.Request, resp *http.Response, err error, duration time.Duration) {
+		ctx := req.Context()
+		attrs := []slog.Attr{
+			slog.String("method", req.Method),
+			slog.String("url", RedactURL(req.URL)),
+			slog.Duration("duration", duration),
+		}
+		if id := RequestID(req); id != "" {
+			attrs = append(attrs, slog.String("request_id", id))
+		}
+		if logger.Enabled(ctx, slog.LevelDebug) {
+			attrs = append(attrs, slog.Any("request_header", RedactHeader(req.Header)))
+		}
+		if err != nil {
+			attrs = append(attrs, slog.String("error", err.Error()))
+			logger.LogAttrs(ctx, slog.LevelError, "http request failed", attrs...)
+			return
+		}
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+		if logger.Enabled(ctx, slog.LevelDebug) {
+			attrs = append(attrs, slog.Any("response_header", RedactHeader(resp.Header)))
+		}
+		level := slog.LevelInfo
+		if resp.StatusCode >= 500 {
+			level = slog.LevelWarn
+		}
+		logger.LogAttrs(ctx, level, "http request", attrs...)
+	})
+}
+
+// RedactHeader RedactedHeadersの値を伏せたコピーを返す
+func RedactHeader(header http.Header) http.Header {
+	ret := header.Clone()
+	for _, k := range RedactedHeaders {
+		if _, ok := ret[http.CanonicalHeaderKey(k)]; ok {
+			ret.Set(k, redacted)
+		}
+	}
+	return ret
+}
+
+// RedactURL ユーザー情報とRedactedQueryParamsの値を伏せたURLを返す
+func RedactURL(u *url.URL) string {
+	ret := *u
+	if ret.User != nil {
+		ret.User = url.User(ret.User.Username())
+	}
+	q := ret.Query()
+	changed := false
+	for k := range q {
+		for _, r := range RedactedQueryParams {
+			if strings.EqualFold(k, r) {
+				q.Set(k, redacted)
+				changed = true
+			}
+		}
+	}
+	if changed {
+		ret.RawQuery = q.Encode()
+	}
+	return ret.String()
+}
@@ -1,11 +1,13 @@
 package network
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"io"
-	"io/ioutil"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/naminomare/gogutil/timer"
 )
@@ -19,42 +21,170 @@ var (
 )
 
 // HTTPWaitClient 一定時間必ず待つ様なクライアント
+// 複数のgoroutineから同時に使える。DoRequestは呼ばれた順にwaitTimerを待ち、リクエストを始める間隔を空ける
+// リクエストそのものは同時に進むので、遅いリクエストがあっても後のリクエストは待たされない
 type HTTPWaitClient struct {
-	waitTimer  *timer.WaitTimer
-	password   string
-	username   string
-	servername string
-	intervalMS int
+	// queue waitTimerを待つ順番。リクエストの間は持たない
+	queue     fifoLock
+	waitTimer *timer.WaitTimer
+
+	// settingsMutex Set系のメソッドとDoRequestが同時に呼ばれても大丈夫なように
+	settingsMutex sync.RWMutex
+	settings      clientSettings
+}
+
+// clientSettings Set系のメソッドで変わる設定
+// DoRequestは最初にコピーを取るので、リクエストの途中で変わっても影響しない
+type clientSettings struct {
+	password    string
+	username    string
+	token       string
+	servername  string
+	intervalMS  int
+	cache       *HTTPCache
+	middlewares []Middleware
+	proxy       *ProxyConfig
+	timeouts    Timeouts
+	metrics     Metrics
+	breaker     *CircuitBreaker
+
+	// transport 接続を使い回すためにリクエスト間で共有する。proxy, servername, timeoutsが変わった時だけ作り直す
+	transport *http.Transport
+
+	maxResponseSize  int64
+	maxDownloadSize  int64
+	minFreeDiskSpace int64
 }
 
 // NewHTTPWaitClient 一定時間必ず待つ様なクライアントを返す
 func NewHTTPWaitClient(intervalMS int, servername string) *HTTPWaitClient {
+	ret := &HTTPWaitClient{
+		waitTimer: timer.NewWaitTimer(),
+		settings: clientSettings{
+			intervalMS: intervalMS,
+			servername: servername,
+			timeouts:   DefaultTimeouts,
+		},
+	}
+	ret.settings.transport = ret.settings.newTransport(ret.settings.timeouts)
+	return ret
+}
+
+// Clone 認証、間隔、プロキシ、タイムアウト、middlewareなどの設定を写した新しいHTTPWaitClientを返す
+// 別のホストに同じ設定で接続する時に使う。servernameは引数のものにする
+// 待ち行列とwaitTimerは別なので、間隔は元のクライアントのリクエストとは別に数える
+// キャッシュはホストごとに分けたいので写さない。接続も共有しない
+func (t *HTTPWaitClient) Clone(servername string) *HTTPWaitClient {
+	settings := t.currentSettings()
+	settings.servername = servername
+	settings.cache = nil
+	settings.middlewares = append([]Middleware(nil), settings.middlewares...)
+	settings.transport = settings.newTransport(settings.timeouts)
 	return &HTTPWaitClient{
-		intervalMS: intervalMS,
-		waitTimer:  timer.NewWaitTimer(),
-		servername: servername,
+		waitTimer: timer.NewWaitTimer(),
+		settings:  settings,
+	}
+}
+
+// updateSettings settingsを書き換える
+// transportに関係する設定が変わった場合はtransportを作り直し、古い方の空いている接続を閉じる
+func (t *HTTPWaitClient) updateSettings(fn func(settings *clientSettings)) {
+	t.settingsMutex.Lock()
+	defer t.settingsMutex.Unlock()
+	before := t.settings.transportKey(t.settings.timeouts)
+	fn(&t.settings)
+	if t.settings.transport != nil && t.settings.transportKey(t.settings.timeouts) == before {
+		return
 	}
+	old := t.settings.transport
+	t.settings.transport = t.settings.newTransport(t.settings.timeouts)
+	if old != nil {
+		old.CloseIdleConnections()
+	}
+}
+
+// currentSettings settingsのコピーを返す
+func (t *HTTPWaitClient) currentSettings() clientSettings {
+	t.settingsMutex.RLock()
+	defer t.settingsMutex.RUnlock()
+	return t.settings
 }
 
 // SetAuth Authをセット
 func (t *HTTPWaitClient) SetAuth(username, password string) {
-	t.password = password
-	t.username = username
+	t.updateSettings(func(settings *clientSettings) {
+		settings.password = password
+		settings.username = username
+	})
+}
+
+// SetBearerToken Authorization: Bearerで送るトークンをセット
+// パーソナルアクセストークンなどで使う。空でない場合はSetAuthより優先する
+func (t *HTTPWaitClient) SetBearerToken(token string) {
+	t.updateSettings(func(settings *clientSettings) {
+		settings.token = token
+	})
 }
 
 // SetServerName サーバー名をいれる。tlsの都合
 func (t *HTTPWaitClient) SetServerName(servername string) {
-	t.servername = servername
+	t.updateSettings(func(settings *clientSettings) {
+		settings.servername = servername
+	})
+}
+
+// SetCache GETのレスポンスをcacheにキャッシュする。nilの場合はキャッシュしない
+func (t *HTTPWaitClient) SetCache(cache *HTTPCache) {
+	t.updateSettings(func(settings *clientSettings) {
+		settings.cache = cache
+	})
+}
+
+// transportKey 値が同じならhttp.Transportを使い回せる
+type transportKey struct {
+	proxy          *ProxyConfig
+	servername     string
+	dial           time.Duration
+	tlsHandshake   time.Duration
+	responseHeader time.Duration
+	idleConn       time.Duration
+}
+
+func (t *clientSettings) transportKey(timeouts Timeouts) transportKey {
+	return transportKey{
+		proxy:          t.proxy,
+		servername:     t.servername,
+		dial:           timeouts.Dial,
+		tlsHandshake:   timeouts.TLSHandshake,
+		responseHeader: timeouts.ResponseHeader,
+		idleConn:       timeouts.IdleConn,
+	}
 }
 
-func createTLSVerifySkipClient(serverName string) *http.Client {
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{ServerName: serverName, InsecureSkipVerify: true},
+func (t *clientSettings) newTransport(timeouts Timeouts) *http.Transport {
+	return &http.Transport{
+		Proxy:                 t.proxyFunc(),
+		DialContext:           newDialer(timeouts).DialContext,
+		TLSClientConfig:       &tls.Config{ServerName: t.servername, InsecureSkipVerify: true},
+		TLSHandshakeTimeout:   timeouts.TLSHandshake,
+		ResponseHeaderTimeout: timeouts.ResponseHeader,
+		IdleConnTimeout:       timeouts.IdleConn,
 	}
-	client := &http.Client{
+}
+
+// createTLSVerifySkipClient timeoutsで使うクライアント
+// transportは共有のものを使う。WithTimeoutsで接続まわりのタイムアウトを変えた時だけ使い捨てのtransportにする
+func (t *clientSettings) createTLSVerifySkipClient(timeouts Timeouts) *http.Client {
+	transport := t.transport
+	if transport == nil || t.transportKey(timeouts) != t.transportKey(t.timeouts) {
+		transport = t.newTransport(timeouts)
+		// 使い捨てなので接続を残さない
+		transport.DisableKeepAlives = true
+	}
+	return &http.Client{
 		Transport: transport,
+		Timeout:   timeouts.Total,
 	}
-	return client
 }
 
 // DoRequest リクエスト
@@ -64,30 +194,121 @@ func (t *HTTPWaitClient) DoRequest(
 	body io.Reader,
 	header map[string]string,
 ) (*http.Response, error) {
-	client := createTLSVerifySkipClient(t.servername)
-	req, err := http.NewRequest(method, url, body)
-	if t.username != "" {
-		req.SetBasicAuth(t.username, t.password)
+	return t.DoRequestContext(context.Background(), method, url, body, header)
+}
+
+// DoRequestContext ctxを使ってリクエストする
+// タイムアウトした場合は*TimeoutErrorを返す。WithTimeoutsでこのリクエストだけタイムアウトを変えられる
+func (t *HTTPWaitClient) DoRequestContext(
+	ctx context.Context,
+	method,
+	url string,
+	body io.Reader,
+	header map[string]string,
+) (*http.Response, error) {
+	settings := t.currentSettings()
+	client := settings.createTLSVerifySkipClient(settings.timeoutsFor(ctx))
+	client.Transport = chainMiddlewares(client.Transport, settings.middlewares)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if settings.token != "" {
+		req.Header.Set("Authorization", "Bearer "+settings.token)
+	} else if settings.username != "" {
+		req.SetBasicAuth(settings.username, settings.password)
 	}
 	for k, v := range header {
 		req.Header.Set(k, v)
 	}
-	t.waitTimer.Wait()
+
+	// キャッシュが新しければサーバーに問い合わせないので待たなくて良い
+	var cached *CacheEntry
+	if settings.cache != nil {
+		var res *http.Response
+		res, cached = settings.cache.lookup(req)
+		if res != nil {
+			return res, nil
+		}
+	}
+
+	if settings.breaker != nil {
+		err = settings.breaker.allow(req.URL.Host)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	metrics := settings.metrics
+	labels := MetricLabels{Host: req.URL.Host, Method: req.Method}
+	var sent *countingReader
+	if metrics != nil && req.Body != nil && req.Body != http.NoBody {
+		sent = &countingReader{ReadCloser: req.Body}
+		req.Body = sent
+	}
+
+	sw := timer.NewStopWatch()
+	sw.Start()
+	// 順番が来たら次の枠を予約してすぐに渡す。遅いリクエストがあっても他のリクエストは待たされない
+	err = t.queue.lock(ctx)
+	if err == nil {
+		err = t.waitTimer.WaitContext(ctx)
+		if err == nil {
+			t.waitTimer.Start(settings.intervalMS)
+		}
+		t.queue.unlock()
+	}
+	if err != nil {
+		if settings.breaker != nil {
+			settings.breaker.cancel(req.URL.Host)
+		}
+		return nil, wrapTimeout(err, method, url)
+	}
+	waited := sw.Stop()
+	sw.Start()
 	res, err := client.Do(req)
-	t.waitTimer.Start(t.intervalMS)
+	latency := sw.Stop()
 
+	if settings.breaker != nil {
+		settings.breaker.done(req.URL.Host, res, err)
+	}
+
+	if metrics != nil {
+		metrics.ObserveRateLimitWait(labels, waited)
+		labels.StatusClass = StatusClassError
+		if err == nil {
+			labels.StatusClass = StatusClass(res.StatusCode)
+		}
+		metrics.ObserveRequest(labels, latency)
+		if retryAttempt(ctx) > 0 {
+			metrics.IncRetries(labels)
+		}
+		if sent != nil {
+			metrics.AddBytesSent(labels, sent.count())
+		}
+	}
+	if err != nil {
+		return nil, wrapTimeout(err, method, url)
+	}
+	res.Body = &timeoutBody{ReadCloser: res.Body, method: method, url: url}
+	if metrics != nil {
+		res.Body = &countingBody{ReadCloser: res.Body, metrics: metrics, labels: labels}
+	}
+	res, err = settings.limitResponse(res)
+	if err == nil && settings.cache != nil {
+		res, err = settings.cache.store(req, res, cached)
+	}
 	return res, err
 }
 
 // ResponseToMap httpResponseをmapにして返します
+//
+// Deprecated: ステータスやContent-Typeも確認するDecodeJSON[map[string]interface{}]か、
+// 構造体にデコードするDecodeJSONを使ってください
 func ResponseToMap(resp *http.Response) (map[string]interface{}, error) {
-	bin, err := ioutil.ReadAll(resp.Body)
 	defer resp.Body.Close()
-	if err != nil {
-		return nil, err
-	}
 	var ret map[string]interface{}
-	err = json.Unmarshal(bin, &ret)
+	err := json.NewDecoder(resp.Body).Decode(&ret)
 	if err != nil {
 		return nil, err
 	}
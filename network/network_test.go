@@ -0,0 +1,487 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// go test -race ./network で実行する
+
+func TestHTTPWaitClientConcurrentUse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(ContentType, ApplicationJSON)
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, `{}`)
+	}))
+	defer srv.Close()
+
+	client := NewHTTPWaitClient(0, "")
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			resp, err := client.DoRequest(http.MethodGet, srv.URL, nil, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}()
+		go func(i int) {
+			defer wg.Done()
+			client.SetAuth("user"+strconv.Itoa(i), "password")
+			client.SetBearerToken("token" + strconv.Itoa(i))
+			client.SetServerName("")
+			client.SetTimeouts(DefaultTimeouts)
+			client.SetMaxResponseSize(1 << 20)
+			client.SetCache(NewHTTPCache(NewMemoryCache(10), time.Minute))
+			client.SetMetrics(NewMemoryMetrics(nil))
+		}(i)
+		go func() {
+			defer wg.Done()
+			client.Use(UserAgentMiddleware("gogutil-test"))
+		}()
+	}
+	wg.Wait()
+}
+
+func TestHTTPWaitClientFIFO(t *testing.T) {
+	var mutex sync.Mutex
+	var order []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		order = append(order, r.URL.Query().Get("n"))
+		mutex.Unlock()
+	}))
+	defer srv.Close()
+
+	client := NewHTTPWaitClient(100, "")
+	resp, err := client.DoRequest(http.MethodGet, srv.URL+"?n=first", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	mutex.Lock()
+	order = nil
+	mutex.Unlock()
+
+	// waitTimerが終わる前に順番に並ばせる
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := client.DoRequest(http.MethodGet, srv.URL+"?n="+strconv.Itoa(i), nil, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+		}(i)
+		waitQueued(t, client, i)
+	}
+	wg.Wait()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(order) != n {
+		t.Fatalf("got %d requests, want %d", len(order), n)
+	}
+	for i, v := range order {
+		if v != strconv.Itoa(i) {
+			t.Fatalf("order = %v", order)
+		}
+	}
+}
+
+// waitQueued 最初のgoroutineがロックを持ち、残りのwaiters個が列に並ぶまで待つ
+func waitQueued(t *testing.T, client *HTTPWaitClient, waiters int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		client.queue.mutex.Lock()
+		ok := client.queue.locked && len(client.queue.waiters) == waiters
+		client.queue.mutex.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d goroutines were not queued", waiters)
+}
+
+func TestHTTPWaitClientSlowRequestDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := NewHTTPWaitClient(10, "")
+	go func() {
+		resp, err := client.DoRequest(http.MethodGet, srv.URL+"/slow", nil, nil)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		resp, err := client.DoRequest(http.MethodGet, srv.URL+"/fast", nil, nil)
+		if err == nil {
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow request blocked the next request")
+	}
+}
+
+func TestHTTPWaitClientQueueCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	client := NewHTTPWaitClient(200, "")
+	resp, err := client.DoRequest(http.MethodGet, srv.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = client.DoRequestContext(ctx, http.MethodGet, srv.URL, nil, nil)
+	if _, ok := err.(*TimeoutError); !ok {
+		t.Fatalf("err = %v, want *TimeoutError", err)
+	}
+
+	// 抜けた後も列が詰まっていない
+	resp, err = client.DoRequest(http.MethodGet, srv.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+// SetMaxResponseSizeより大きくても、WriteDownloadはSetMaxDownloadSizeまで書ける
+func TestWriteDownloadIgnoresMaxResponseSize(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 4<<10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	client := NewHTTPWaitClient(0, "")
+	client.SetMaxResponseSize(1024)
+	client.SetMaxDownloadSize(1 << 20)
+
+	resp, err := client.DoRequest(http.MethodGet, srv.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	n, err := client.WriteDownload(&buf, resp, "")
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(body)) || !bytes.Equal(buf.Bytes(), body) {
+		t.Fatalf("wrote %d bytes, want %d", n, len(body))
+	}
+
+	// ダウンロード以外では今まで通りSetMaxResponseSizeで止まる
+	resp, err = client.DoRequest(http.MethodGet, srv.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	var lerr *SizeLimitError
+	if !errors.As(err, &lerr) || lerr.Kind != SizeLimitResponse {
+		t.Fatalf("err = %v, want response *SizeLimitError", err)
+	}
+
+	// SetMaxDownloadSizeを超える場合はWriteDownloadが断る
+	client.SetMaxDownloadSize(2 << 10)
+	resp, err = client.DoRequest(http.MethodGet, srv.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.WriteDownload(io.Discard, resp, "")
+	resp.Body.Close()
+	if !errors.As(err, &lerr) || lerr.Kind != SizeLimitDownload {
+		t.Fatalf("err = %v, want download *SizeLimitError", err)
+	}
+}
+
+// transportを共有するので、続けてリクエストしても接続を使い回す
+func TestHTTPWaitClientReusesConnections(t *testing.T) {
+	var mutex sync.Mutex
+	conns := 0
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mutex.Lock()
+			conns++
+			mutex.Unlock()
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	get := func(client *HTTPWaitClient) {
+		resp, err := client.DoRequest(http.MethodGet, srv.URL, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	count := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return conns
+	}
+
+	client := NewHTTPWaitClient(0, "")
+	for i := 0; i < 5; i++ {
+		get(client)
+	}
+	if n := count(); n != 1 {
+		t.Fatalf("%d connections for 5 requests, want 1", n)
+	}
+
+	// 接続に関係ない設定を変えても使い回す
+	client.SetAuth("user", "password")
+	get(client)
+	if n := count(); n != 1 {
+		t.Fatalf("%d connections after SetAuth, want 1", n)
+	}
+
+	// 接続に関係する設定を変えたら作り直す
+	timeouts := DefaultTimeouts
+	timeouts.IdleConn = time.Minute
+	client.SetTimeouts(timeouts)
+	get(client)
+	if n := count(); n != 2 {
+		t.Fatalf("%d connections after SetTimeouts, want 2", n)
+	}
+}
+
+// 閉 → 開 → 半開き → 閉 の遷移
+func TestCircuitBreaker(t *testing.T) {
+	var mutex sync.Mutex
+	fail := true
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		hits++
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+	setFail := func(v bool) {
+		mutex.Lock()
+		fail = v
+		mutex.Unlock()
+	}
+	hitCount := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return hits
+	}
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var transitions []string
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{
+		ConsecutiveFailures: 3,
+		CoolDown:            time.Minute,
+		OnStateChange: func(host string, from, to CircuitState) {
+			transitions = append(transitions, from.String()+"->"+to.String())
+		},
+	})
+	breaker.Now = func() time.Time { return now }
+	client := NewHTTPWaitClient(0, "")
+	client.SetCircuitBreaker(breaker)
+	host := srv.Listener.Addr().String()
+
+	get := func() (int, error) {
+		resp, err := client.DoRequest(http.MethodGet, srv.URL, nil, nil)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+	expectState := func(want CircuitState) {
+		t.Helper()
+		if got := breaker.State(host); got != want {
+			t.Fatalf("state = %v, want %v", got, want)
+		}
+	}
+
+	// 成功を挟むと続けての失敗は数え直す
+	get()
+	get()
+	setFail(false)
+	get()
+	setFail(true)
+	get()
+	get()
+	expectState(CircuitClosed)
+	get()
+	expectState(CircuitOpen)
+
+	// 開いている間はリクエストしない
+	before := hitCount()
+	_, err := get()
+	var oerr *CircuitOpenError
+	if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &oerr) || !oerr.RetryAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("err = %v, want *CircuitOpenError retrying at %v", err, now.Add(time.Minute))
+	}
+	if hitCount() != before {
+		t.Fatal("request was sent while the circuit was open")
+	}
+
+	// クールダウン後の試しのリクエストが失敗したらまた開く
+	now = now.Add(time.Minute)
+	expectState(CircuitHalfOpen)
+	if status, err := get(); err != nil || status != http.StatusInternalServerError {
+		t.Fatalf("probe = %d, %v", status, err)
+	}
+	expectState(CircuitOpen)
+
+	// 試しのリクエストが成功したら閉じる
+	now = now.Add(time.Minute)
+	setFail(false)
+	if status, err := get(); err != nil || status != http.StatusOK {
+		t.Fatalf("probe = %d, %v", status, err)
+	}
+	expectState(CircuitClosed)
+	if _, err := get(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"closed->open",
+		"open->half-open",
+		"half-open->open",
+		"open->half-open",
+		"half-open->closed",
+	}
+	if strings.Join(transitions, ",") != strings.Join(want, ",") {
+		t.Fatalf("transitions = %v, want %v", transitions, want)
+	}
+}
+
+// Windowの間の失敗の割合で開く
+func TestCircuitBreakerErrorRate(t *testing.T) {
+	var mutex sync.Mutex
+	n := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		n++
+		// 2回に1回失敗する
+		if n%2 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{
+		ErrorRate:   0.5,
+		MinRequests: 4,
+		Window:      time.Minute,
+	})
+	breaker.Now = func() time.Time { return now }
+	client := NewHTTPWaitClient(0, "")
+	client.SetCircuitBreaker(breaker)
+	host := srv.Listener.Addr().String()
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.DoRequest(http.MethodGet, srv.URL, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// MinRequestsに足りないうちは開かない
+	if got := breaker.State(host); got != CircuitClosed {
+		t.Fatalf("state = %v after 3 requests, want closed", got)
+	}
+	resp, err := client.DoRequest(http.MethodGet, srv.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := breaker.State(host); got != CircuitOpen {
+		t.Fatalf("state = %v after 2 failures in 4 requests, want open", got)
+	}
+}
+
+func TestHTTPWaitClientClone(t *testing.T) {
+	var mutex sync.Mutex
+	var auths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		auths = append(auths, r.Header.Get("Authorization")+" "+r.Header.Get("User-Agent"))
+		mutex.Unlock()
+	}))
+	defer srv.Close()
+
+	src := NewHTTPWaitClient(100, "confluence.example.com")
+	src.SetBearerToken("token")
+	src.Use(UserAgentMiddleware("gogutil-test"))
+	src.SetCache(NewHTTPCache(NewMemoryCache(10), time.Minute))
+
+	clone := src.Clone("")
+	settings := clone.currentSettings()
+	if settings.servername != "" || settings.intervalMS != 100 || settings.cache != nil {
+		t.Fatalf("clone settings: servername %q, interval %d, cache %v", settings.servername, settings.intervalMS, settings.cache)
+	}
+	if settings.transport == src.currentSettings().transport {
+		t.Fatal("clone shares the transport")
+	}
+	// 写した後に元の設定を変えても影響しない
+	src.SetBearerToken("changed")
+
+	resp, err := clone.DoRequest(http.MethodGet, srv.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(auths) != 1 || auths[0] != "Bearer token gogutil-test" {
+		t.Fatalf("request headers = %q", auths)
+	}
+}
@@ -0,0 +1,157 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var (
+	// ErrUnsupportedProxyScheme http, https, socks5以外のプロキシの時
+	ErrUnsupportedProxyScheme = errors.New("対応していないプロキシのスキームです")
+)
+
+// ProxyConfig プロキシの設定
+type ProxyConfig struct {
+	// HTTPProxy http://への通信に使うプロキシ。http://, https://, socks5://が使える
+	HTTPProxy string
+	// HTTPSProxy https://への通信に使うプロキシ。空の場合はHTTPProxyを使う
+	HTTPSProxy string
+	// Username, Password プロキシの認証。空の場合はプロキシのURLに含まれるものを使う
+	Username string
+	Password string
+	// NoProxy プロキシを通さないホスト
+	// "example.com"はサブドメインも含む。".example.com"はサブドメインのみ
+	// "10.0.0.0/8"のようなCIDR、"host:port"、すべてを表す"*"も使える
+	NoProxy []string
+}
+
+// ProxyConfigFromEnvironment HTTP_PROXY, HTTPS_PROXY, NO_PROXYから設定を作る
+// 小文字の環境変数も見る
+func ProxyConfigFromEnvironment() *ProxyConfig {
+	ret := &ProxyConfig{
+		HTTPProxy:  getenvAny("HTTP_PROXY", "http_proxy"),
+		HTTPSProxy: getenvAny("HTTPS_PROXY", "https_proxy"),
+	}
+	for _, v := range strings.Split(getenvAny("NO_PROXY", "no_proxy"), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			ret.NoProxy = append(ret.NoProxy, v)
+		}
+	}
+	return ret
+}
+
+func getenvAny(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// SetProxy プロキシを設定する
+// nilの場合は環境変数に従う(デフォルト)
+func (t *HTTPWaitClient) SetProxy(config *ProxyConfig) error {
+	if config == nil {
+		t.updateSettings(func(settings *clientSettings) {
+			settings.proxy = nil
+		})
+		return nil
+	}
+	for _, v := range []string{config.HTTPProxy, config.HTTPSProxy} {
+		if v == "" {
+			continue
+		}
+		if _, err := parseProxyURL(v); err != nil {
+			return err
+		}
+	}
+	copied := *config
+	copied.NoProxy = append([]string(nil), config.NoProxy...)
+	t.updateSettings(func(settings *clientSettings) {
+		settings.proxy = &copied
+	})
+	return nil
+}
+
+// proxyFunc http.Transport.Proxyに渡す関数を返す
+func (t *clientSettings) proxyFunc() func(*http.Request) (*url.URL, error) {
+	config := t.proxy
+	if config == nil {
+		return http.ProxyFromEnvironment
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(config.NoProxy, req.URL) {
+			return nil, nil
+		}
+		proxy := config.HTTPProxy
+		if req.URL.Scheme == "https" && config.HTTPSProxy != "" {
+			proxy = config.HTTPSProxy
+		}
+		if proxy == "" {
+			return nil, nil
+		}
+		u, err := parseProxyURL(proxy)
+		if err != nil {
+			return nil, err
+		}
+		if config.Username != "" {
+			u.User = url.UserPassword(config.Username, config.Password)
+		}
+		return u, nil
+	}
+}
+
+func parseProxyURL(proxy string) (*url.URL, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return u, nil
+	}
+	return nil, ErrUnsupportedProxyScheme
+}
+
+// bypassProxy targetがnoProxyに含まれるか
+func bypassProxy(noProxy []string, target *url.URL) bool {
+	host := strings.ToLower(target.Hostname())
+	port := target.Port()
+	ip := net.ParseIP(host)
+	for _, v := range noProxy {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "*" {
+			return true
+		}
+		if _, cidr, err := net.ParseCIDR(v); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if h, p, err := net.SplitHostPort(v); err == nil {
+			if p != port {
+				continue
+			}
+			v = h
+		}
+		if strings.HasPrefix(v, ".") {
+			if strings.HasSuffix(host, v) {
+				return true
+			}
+			continue
+		}
+		if host == v || strings.HasSuffix(host, "."+v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package network
+
+import (
+	"context"
+	"sync"
+)
+
+// fifoLock 来た順にロックを渡すロック
+// sync.Mutexは順番を保証しないので、レートリミットで待つgoroutineが追い越されないようにする
+type fifoLock struct {
+	mutex   sync.Mutex
+	locked  bool
+	waiters []chan struct{}
+}
+
+// lock 順番が来るまで待つ。ctxが先に終わった場合は列から抜けてctx.Err()を返す
+func (t *fifoLock) lock(ctx context.Context) error {
+	t.mutex.Lock()
+	if !t.locked {
+		t.locked = true
+		t.mutex.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	t.waiters = append(t.waiters, ready)
+	t.mutex.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for i, v := range t.waiters {
+		if v == ready {
+			t.waiters = append(t.waiters[:i], t.waiters[i+1:]...)
+			return ctx.Err()
+		}
+	}
+	// 抜ける前にロックを渡されていたので次に回す
+	t.unlockLocked()
+	return ctx.Err()
+}
+
+func (t *fifoLock) unlock() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.unlockLocked()
+}
+
+func (t *fifoLock) unlockLocked() {
+	if len(t.waiters) == 0 {
+		t.locked = false
+		return
+	}
+	next := t.waiters[0]
+	t.waiters = t.waiters[1:]
+	close(next)
+}
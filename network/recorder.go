@@ -0,0 +1,247 @@
+package network
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// RecorderMode 記録するか再生するか
+type RecorderMode int
+
+const (
+	// RecorderModeRecord 実際に通信して記録する
+	RecorderModeRecord RecorderMode = iota
+	// RecorderModeReplay 記録から返す。通信はしない
+	RecorderModeReplay
+)
+
+var (
+	// ErrNoInteraction 再生時に一致する記録が無い時
+	ErrNoInteraction = errors.New("一致する記録がありません")
+
+	bodyEncodingBase64 = "base64"
+	multipartBoundary  = "RECORDER-BOUNDARY"
+)
+
+// Cassette 記録したリクエストとレスポンスの組
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction リクエストとレスポンスの組
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest 記録したリクエスト
+type RecordedRequest struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	Header       http.Header `json:"header"`
+	Body         string      `json:"body"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty"`
+}
+
+// RecordedResponse 記録したレスポンス
+type RecordedResponse struct {
+	StatusCode   int         `json:"statusCode"`
+	Header       http.Header `json:"header"`
+	Body         string      `json:"body"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty"`
+}
+
+// Recorder リクエストとレスポンスをファイルに記録・再生する
+// Middlewareで取り付ける。認証情報はRedactHeader, RedactURLで伏せて保存する
+type Recorder struct {
+	mu       sync.Mutex
+	path     string
+	mode     RecorderMode
+	cassette Cassette
+	used     []bool
+}
+
+// NewRecorder pathのカセットを使うRecorderを返す
+// RecorderModeReplayの場合はpathを読み込む
+func NewRecorder(path string, mode RecorderMode) (*Recorder, error) {
+	ret := &Recorder{
+		path: path,
+		mode: mode,
+	}
+	if mode == RecorderModeReplay {
+		bin, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(bin, &ret.cassette)
+		if err != nil {
+			return nil, err
+		}
+		ret.used = make([]bool, len(ret.cassette.Interactions))
+	}
+	return ret, nil
+}
+
+// Save 記録をファイルに書き出す
+func (t *Recorder) Save() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	bin, err := json.MarshalIndent(t.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := t.path + ".tmp"
+	err = ioutil.WriteFile(tmp, bin, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.path)
+}
+
+// Middleware HTTPWaitClient.Useに渡すMiddlewareを返す
+func (t *Recorder) Middleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			recorded, err := recordRequest(req)
+			if err != nil {
+				return nil, err
+			}
+			if t.mode == RecorderModeReplay {
+				return t.replay(req, recorded)
+			}
+
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				return nil, err
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			encoded, encoding := encodeBody(body)
+			t.mu.Lock()
+			t.cassette.Interactions = append(t.cassette.Interactions, Interaction{
+				Request: *recorded,
+				Response: RecordedResponse{
+					StatusCode:   resp.StatusCode,
+					Header:       RedactHeader(resp.Header),
+					Body:         encoded,
+					BodyEncoding: encoding,
+				},
+			})
+			t.mu.Unlock()
+			return resp, nil
+		})
+	}
+}
+
+// replay method, URL, bodyが一致する記録のうち、まだ使っていない最初のものを返す
+// すべて使い終わっている場合は最後に一致したものを返す
+func (t *Recorder) replay(req *http.Request, recorded *RecordedRequest) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	found := -1
+	for i, v := range t.cassette.Interactions {
+		if !matchRecordedRequest(&v.Request, recorded) {
+			continue
+		}
+		found = i
+		if !t.used[i] {
+			break
+		}
+	}
+	if found < 0 {
+		return nil, ErrNoInteraction
+	}
+	t.used[found] = true
+
+	res := t.cassette.Interactions[found].Response
+	body, err := decodeBody(res.Body, res.BodyEncoding)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(res.StatusCode) + " " + http.StatusText(res.StatusCode),
+		StatusCode:    res.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        res.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func matchRecordedRequest(a, b *RecordedRequest) bool {
+	return a.Method == b.Method && a.URL == b.URL && a.Body == b.Body
+}
+
+// recordRequest reqを記録用にする。reqのbodyは読み直せるように戻す
+func recordRequest(req *http.Request) (*RecordedRequest, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	// multipartのboundaryは毎回変わるので固定する
+	header := RedactHeader(req.Header)
+	if mediaType, params, err := mime.ParseMediaType(req.Header.Get(ContentType)); err == nil && params["boundary"] != "" {
+		body = bytes.ReplaceAll(body, []byte(params["boundary"]), []byte(multipartBoundary))
+		params["boundary"] = multipartBoundary
+		header.Set(ContentType, mime.FormatMediaType(mediaType, params))
+	}
+
+	encoded, encoding := encodeBody(body)
+	return &RecordedRequest{
+		Method:       req.Method,
+		URL:          normalizeURL(req.URL),
+		Header:       header,
+		Body:         encoded,
+		BodyEncoding: encoding,
+	}, nil
+}
+
+// normalizeURL クエリの順番を揃えて認証情報を伏せる
+func normalizeURL(u *url.URL) string {
+	ret, err := url.Parse(RedactURL(u))
+	if err != nil {
+		return u.String()
+	}
+	ret.RawQuery = ret.Query().Encode()
+	return strings.TrimSuffix(ret.String(), "?")
+}
+
+func encodeBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), bodyEncodingBase64
+}
+
+func decodeBody(body, encoding string) ([]byte, error) {
+	if encoding == bodyEncodingBase64 {
+		return base64.StdEncoding.DecodeString(body)
+	}
+	return []byte(body), nil
+}
@@ -0,0 +1,119 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// Timeouts タイムアウトの設定。0の場合は無制限
+type Timeouts struct {
+	// Dial 接続するまで
+	Dial time.Duration
+	// TLSHandshake TLSのハンドシェイク
+	TLSHandshake time.Duration
+	// ResponseHeader リクエストを送ってからレスポンスヘッダが返ってくるまで
+	ResponseHeader time.Duration
+	// IdleConn 使っていない接続を閉じるまで
+	IdleConn time.Duration
+	// Total bodyを読み終わるまでの全体
+	Total time.Duration
+}
+
+var (
+	// DefaultTimeouts NewHTTPWaitClientで使うタイムアウト
+	// ダウンロードが長くなることがあるのでTotalは無制限
+	DefaultTimeouts = Timeouts{
+		Dial:           30 * time.Second,
+		TLSHandshake:   10 * time.Second,
+		ResponseHeader: 60 * time.Second,
+		IdleConn:       90 * time.Second,
+	}
+)
+
+// TimeoutError タイムアウトした時のエラー
+type TimeoutError struct {
+	Method string
+	URL    string
+	Err    error
+}
+
+func (t *TimeoutError) Error() string {
+	return "timeout: " + t.Method + " " + t.URL + ": " + t.Err.Error()
+}
+
+// Unwrap Errを返す
+func (t *TimeoutError) Unwrap() error {
+	return t.Err
+}
+
+// Timeout net.Errorと同じく判定できるように
+func (t *TimeoutError) Timeout() bool {
+	return true
+}
+
+type timeoutsKey struct{}
+
+// WithTimeouts 1回のリクエストだけタイムアウトを変える時に使う
+// DoRequestContextにctxを渡す
+func WithTimeouts(ctx context.Context, timeouts Timeouts) context.Context {
+	return context.WithValue(ctx, timeoutsKey{}, timeouts)
+}
+
+// SetTimeouts タイムアウトを設定する
+func (t *HTTPWaitClient) SetTimeouts(timeouts Timeouts) {
+	t.updateSettings(func(settings *clientSettings) {
+		settings.timeouts = timeouts
+	})
+}
+
+func (t *clientSettings) timeoutsFor(ctx context.Context) Timeouts {
+	if v, ok := ctx.Value(timeoutsKey{}).(Timeouts); ok {
+		return v
+	}
+	return t.timeouts
+}
+
+func newDialer(timeouts Timeouts) *net.Dialer {
+	return &net.Dialer{
+		Timeout:   timeouts.Dial,
+		KeepAlive: 30 * time.Second,
+	}
+}
+
+func isTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// wrapTimeout タイムアウトのエラーを*TimeoutErrorにする
+func wrapTimeout(err error, method, url string) error {
+	if !isTimeout(err) {
+		return err
+	}
+	var te *TimeoutError
+	if errors.As(err, &te) {
+		return err
+	}
+	return &TimeoutError{Method: method, URL: url, Err: err}
+}
+
+// timeoutBody bodyを読んでいる途中のタイムアウトも*TimeoutErrorにする
+type timeoutBody struct {
+	io.ReadCloser
+	method string
+	url    string
+}
+
+func (t *timeoutBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	return n, wrapTimeout(err, t.method, t.url)
+}
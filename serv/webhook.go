@@ -0,0 +1,363 @@
+package serv
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebhookEventType Confluenceのwebhookのイベント名
+type WebhookEventType string
+
+var (
+	// WebhookPageCreated ページ作成
+	WebhookPageCreated WebhookEventType = "page_created"
+	// WebhookPageUpdated ページ更新
+	WebhookPageUpdated WebhookEventType = "page_updated"
+	// WebhookPageRemoved ページ削除
+	WebhookPageRemoved WebhookEventType = "page_removed"
+	// WebhookAttachmentCreated 添付ファイル追加
+	WebhookAttachmentCreated WebhookEventType = "attachment_created"
+	// WebhookCommentCreated コメント追加
+	WebhookCommentCreated WebhookEventType = "comment_created"
+
+	// WebhookSignatureHeader 署名が入っているヘッダ。値は"sha256=<hex>"
+	WebhookSignatureHeader = "X-Hub-Signature"
+
+	// DefaultWebhookMaxBodySize WebhookHandler.MaxBodySizeが0の時に使う
+	DefaultWebhookMaxBodySize int64 = 1 << 20
+
+	// ErrWebhookSignature 署名が無い、または合わない時
+	ErrWebhookSignature = errors.New("webhookの署名が不正です")
+
+	// ErrWebhookPayload payloadが読めない時
+	ErrWebhookPayload = errors.New("webhookのpayloadが不正です")
+
+	// ErrWebhookPanic 登録された関数がpanicした時
+	ErrWebhookPanic = errors.New("webhookの関数がpanicしました")
+)
+
+// WebhookID ID。Confluenceのバージョンによって数値と文字列のどちらでも来るので文字列にそろえる
+type WebhookID string
+
+// UnmarshalJSON 数値でも文字列でも受け付ける
+func (t *WebhookID) UnmarshalJSON(bin []byte) error {
+	if bytes.Equal(bin, []byte("null")) {
+		*t = ""
+		return nil
+	}
+	var s string
+	if json.Unmarshal(bin, &s) == nil {
+		*t = WebhookID(s)
+		return nil
+	}
+	var n json.Number
+	err := json.Unmarshal(bin, &n)
+	if err != nil {
+		return err
+	}
+	*t = WebhookID(n.String())
+	return nil
+}
+
+// WebhookPage イベントのページ
+// 日時はUnixミリ秒
+type WebhookPage struct {
+	ID                    WebhookID `json:"id"`
+	Title                 string    `json:"title"`
+	SpaceKey              string    `json:"spaceKey"`
+	Version               int       `json:"version"`
+	Self                  string    `json:"self"`
+	CreatorAccountID      string    `json:"creatorAccountId"`
+	CreatorName           string    `json:"creatorName"`
+	LastModifierAccountID string    `json:"lastModifierAccountId"`
+	LastModifierName      string    `json:"lastModifierName"`
+	CreationDate          int64     `json:"creationDate"`
+	ModificationDate      int64     `json:"modificationDate"`
+}
+
+// WebhookAttachment イベントの添付ファイル
+type WebhookAttachment struct {
+	ID               WebhookID `json:"id"`
+	FileName         string    `json:"fileName"`
+	FileSize         int64     `json:"fileSize"`
+	MediaType        string    `json:"mediaType"`
+	Comment          string    `json:"comment"`
+	Version          int       `json:"version"`
+	Self             string    `json:"self"`
+	CreatorAccountID string    `json:"creatorAccountId"`
+	CreatorName      string    `json:"creatorName"`
+	CreationDate     int64     `json:"creationDate"`
+	ModificationDate int64     `json:"modificationDate"`
+	// Container 添付先のページ
+	Container WebhookPage `json:"container"`
+}
+
+// WebhookComment イベントのコメント
+type WebhookComment struct {
+	ID               WebhookID `json:"id"`
+	Version          int       `json:"version"`
+	Self             string    `json:"self"`
+	CreatorAccountID string    `json:"creatorAccountId"`
+	CreatorName      string    `json:"creatorName"`
+	CreationDate     int64     `json:"creationDate"`
+	ModificationDate int64     `json:"modificationDate"`
+	// Parent コメントしたページ
+	Parent WebhookPage `json:"parent"`
+}
+
+// WebhookEvent webhookで送られてきたイベント
+// Page, Attachment, CommentはTypeに合わせてどれかが入る
+type WebhookEvent struct {
+	Type WebhookEventType
+	// Timestamp イベントの日時(Unixミリ秒)
+	Timestamp     int64
+	UserAccountID string
+	UserName      string
+
+	Page       *WebhookPage
+	Attachment *WebhookAttachment
+	Comment    *WebhookComment
+
+	// Raw 受け取ったpayloadそのもの。型に無い値を読む用
+	Raw json.RawMessage
+}
+
+// Time Timestampをtime.Timeにする
+func (t *WebhookEvent) Time() time.Time {
+	return time.UnixMilli(t.Timestamp)
+}
+
+// PageID イベントに関係するページのID。再インデックスなどに使う
+// 添付ファイルは添付先、コメントはコメントしたページ
+func (t *WebhookEvent) PageID() string {
+	switch {
+	case t.Page != nil:
+		return string(t.Page.ID)
+	case t.Attachment != nil:
+		return string(t.Attachment.Container.ID)
+	case t.Comment != nil:
+		return string(t.Comment.Parent.ID)
+	}
+	return ""
+}
+
+// webhookPayload 受け取るjson
+// イベント名はServerでは"event"、Cloudでは"webhookEvent"に入る
+type webhookPayload struct {
+	Event         WebhookEventType   `json:"event"`
+	WebhookEvent  WebhookEventType   `json:"webhookEvent"`
+	Timestamp     int64              `json:"timestamp"`
+	UserAccountID string             `json:"userAccountId"`
+	User          string             `json:"user"`
+	Page          *WebhookPage       `json:"page"`
+	Attachment    *WebhookAttachment `json:"attachment"`
+	AttachedTo    *WebhookPage       `json:"attachedTo"`
+	Comment       *WebhookComment    `json:"comment"`
+}
+
+// ParseWebhookEvent payloadをWebhookEventにする
+// 知らないイベントでもTypeとRawは入れて返す
+func ParseWebhookEvent(payload []byte) (*WebhookEvent, error) {
+	var p webhookPayload
+	err := json.Unmarshal(payload, &p)
+	if err != nil {
+		return nil, ErrWebhookPayload
+	}
+	ret := &WebhookEvent{
+		Type:          p.Event,
+		Timestamp:     p.Timestamp,
+		UserAccountID: p.UserAccountID,
+		UserName:      p.User,
+		Raw:           append(json.RawMessage(nil), payload...),
+	}
+	if ret.Type == "" {
+		ret.Type = p.WebhookEvent
+	}
+	if ret.Type == "" {
+		return nil, ErrWebhookPayload
+	}
+
+	switch ret.Type {
+	case WebhookPageCreated, WebhookPageUpdated, WebhookPageRemoved:
+		if p.Page == nil {
+			return nil, ErrWebhookPayload
+		}
+		ret.Page = p.Page
+	case WebhookAttachmentCreated:
+		if p.Attachment == nil {
+			return nil, ErrWebhookPayload
+		}
+		if p.Attachment.Container.ID == "" && p.AttachedTo != nil {
+			p.Attachment.Container = *p.AttachedTo
+		}
+		ret.Attachment = p.Attachment
+	case WebhookCommentCreated:
+		if p.Comment == nil {
+			return nil, ErrWebhookPayload
+		}
+		ret.Comment = p.Comment
+	default:
+		ret.Page = p.Page
+		ret.Attachment = p.Attachment
+		ret.Comment = p.Comment
+	}
+	return ret, nil
+}
+
+// SignWebhook payloadの署名。WebhookSignatureHeaderに入れる値
+func SignWebhook(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature signatureがpayloadをsecretで署名したものか確認する
+func VerifyWebhookSignature(secret string, payload []byte, signature string) error {
+	hexSum, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return ErrWebhookSignature
+	}
+	sum, err := hex.DecodeString(hexSum)
+	if err != nil {
+		return ErrWebhookSignature
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return ErrWebhookSignature
+	}
+	return nil
+}
+
+// WebhookHandlerFunc イベントを受け取る関数
+// errorを返すとwebhookに500を返すので、Confluenceが再送する
+type WebhookHandlerFunc func(ctx context.Context, event *WebhookEvent) error
+
+// WebhookHandler Confluenceのwebhookを受けるhttp.Handler
+// Handleなどの登録はServeHTTPと同時に呼んでも大丈夫
+type WebhookHandler struct {
+	secret string
+
+	// MaxBodySize 受け付けるpayloadの最大サイズ。0の場合はDefaultWebhookMaxBodySize
+	MaxBodySize int64
+	// OnError ServeHTTPで関数がerrorを返したりpanicした時に呼ばれる。nilの場合はlogに出す
+	// レスポンスには中身を出さず500だけ返す
+	OnError func(err error)
+
+	mutex    sync.RWMutex
+	handlers map[WebhookEventType][]WebhookHandlerFunc
+	all      []WebhookHandlerFunc
+}
+
+// NewWebhookHandler WebhookHandlerを返す
+// secretが空の場合は署名を確認しない
+func NewWebhookHandler(secret string) *WebhookHandler {
+	return &WebhookHandler{
+		secret:   secret,
+		handlers: map[WebhookEventType][]WebhookHandlerFunc{},
+	}
+}
+
+// Handle eventTypeのイベントを受け取る関数を登録する
+func (t *WebhookHandler) Handle(eventType WebhookEventType, fn WebhookHandlerFunc) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.handlers[eventType] = append(t.handlers[eventType], fn)
+}
+
+// HandleAll すべてのイベントを受け取る関数を登録する
+func (t *WebhookHandler) HandleAll(fn WebhookHandlerFunc) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.all = append(t.all, fn)
+}
+
+// Dispatch eventを登録された関数に渡す
+// 関数は別々のgoroutineで同時に呼び、全部終わるまで待つ。errorはerrors.Joinでまとめて返す
+// 関数がpanicした場合はErrWebhookPanicをwrapしたerrorにする
+func (t *WebhookHandler) Dispatch(ctx context.Context, event *WebhookEvent) error {
+	t.mutex.RLock()
+	var fns []WebhookHandlerFunc
+	fns = append(fns, t.handlers[event.Type]...)
+	fns = append(fns, t.all...)
+	t.mutex.RUnlock()
+
+	errs := make([]error, len(fns))
+	wg := sync.WaitGroup{}
+	for i, fn := range fns {
+		wg.Add(1)
+		go func(i int, fn WebhookHandlerFunc) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					errs[i] = fmt.Errorf("%w: %v\n%s", ErrWebhookPanic, r, debug.Stack())
+				}
+			}()
+			errs[i] = fn(ctx, event)
+		}(i, fn)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// ServeHTTP POSTされたpayloadを確認してDispatchする
+func (t *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	maxBodySize := t.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultWebhookMaxBodySize
+	}
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if int64(len(payload)) > maxBodySize {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if t.secret != "" {
+		err = VerifyWebhookSignature(t.secret, payload, r.Header.Get(WebhookSignatureHeader))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+	event, err := ParseWebhookEvent(payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = t.Dispatch(r.Context(), event)
+	if err != nil {
+		t.reportError(err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (t *WebhookHandler) reportError(err error) {
+	if t.OnError != nil {
+		t.OnError(err)
+		return
+	}
+	log.Printf("serv: webhook: %v", err)
+}
@@ -1,9 +1,15 @@
 package timer
 
-import "time"
+import (
+	"context"
+	"sync"
+	"time"
+)
 
 // WaitTimer 一定時間ブロックするタイマー
+// 複数のgoroutineから使える
 type WaitTimer struct {
+	mutex  sync.Mutex
 	isDone chan struct{}
 }
 
@@ -15,18 +21,35 @@ func NewWaitTimer() *WaitTimer {
 // Start タイマーを実行する
 func (t *WaitTimer) Start(intervalMs int) {
 	t.Wait()
-	t.isDone = make(chan struct{})
+	isDone := make(chan struct{})
+	t.mutex.Lock()
+	t.isDone = isDone
+	t.mutex.Unlock()
 	go func() {
 		time.Sleep(time.Duration(intervalMs) * time.Millisecond)
 
-		close(t.isDone)
+		close(isDone)
 	}()
 }
 
 // Wait ブロックします
 func (t *WaitTimer) Wait() {
-	if t.isDone == nil {
-		return
+	t.WaitContext(context.Background())
+}
+
+// WaitContext ctxが終わるまでブロックします
+// ctxが先に終わった場合はctx.Err()を返す
+func (t *WaitTimer) WaitContext(ctx context.Context) error {
+	t.mutex.Lock()
+	isDone := t.isDone
+	t.mutex.Unlock()
+	if isDone == nil {
+		return nil
+	}
+	select {
+	case <-isDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	<-t.isDone
 }